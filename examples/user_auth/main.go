@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"path/filepath"
 
-	"github.com/temirov/GAuss/pkg/constants"
 	"github.com/temirov/GAuss/pkg/gauss"
 	"github.com/temirov/GAuss/pkg/session"
 	"github.com/temirov/utils/system"
@@ -29,11 +28,17 @@ func main() {
 	googleClientID := system.GetEnvOrFail("GOOGLE_CLIENT_ID")
 	googleClientSecret := system.GetEnvOrFail("GOOGLE_CLIENT_SECRET")
 
-	session.NewSession([]byte(clientSecret))
+	sessionStore := session.NewCookieStore([]byte(clientSecret))
 
 	customLoginTemplate := *loginTemplateFlag
 
-	authService, err := gauss.NewService(googleClientID, googleClientSecret, appBase, DashboardPath, gauss.ScopeStrings(gauss.DefaultScopes), customLoginTemplate)
+	authService, err := gauss.New(googleClientID, googleClientSecret,
+		gauss.WithBaseURL(appBase),
+		gauss.WithPostLoginURL(DashboardPath),
+		gauss.WithScopes(gauss.ScopeStrings(gauss.DefaultScopes)...),
+		gauss.WithLoginTemplate(customLoginTemplate),
+		gauss.WithSessionStore(sessionStore),
+	)
 	if err != nil {
 		log.Fatalf("Failed to initialize auth service: %v", err)
 	}
@@ -58,22 +63,17 @@ func main() {
 	dashService := dash.NewService()
 	dashHandlers := dash.NewHandlers(dashService, templates)
 
-	mux.Handle(DashboardPath, gauss.AuthMiddleware(http.HandlerFunc(dashHandlers.Dashboard)))
+	mux.Handle(DashboardPath, authHandlers.AuthMiddleware(http.HandlerFunc(dashHandlers.Dashboard)))
 
 	// Register root handler with middleware.
-	mux.Handle(Root, gauss.AuthMiddleware(http.HandlerFunc(rootHandler)))
+	mux.Handle(Root, authHandlers.AuthMiddleware(http.HandlerFunc(rootHandler)))
 
 	log.Printf("Server starting on :8080")
 	log.Fatal(http.ListenAndServe("localhost:8080", mux))
 }
 
+// rootHandler only runs for logged-in users because AuthMiddleware redirects
+// everyone else to the login page, so it simply forwards to the dashboard.
 func rootHandler(responseWriter http.ResponseWriter, request *http.Request) {
-	webSession, _ := session.Store().Get(request, constants.SessionName)
-	if webSession.Values[constants.SessionKeyUserEmail] != nil {
-		// User is logged in, redirect to dashboard.
-		http.Redirect(responseWriter, request, DashboardPath, http.StatusFound)
-		return
-	}
-	// If not logged in, the middleware will handle the redirect to login.
-	http.NotFound(responseWriter, request)
+	http.Redirect(responseWriter, request, DashboardPath, http.StatusFound)
 }
@@ -2,7 +2,7 @@ package dash
 
 import (
 	"github.com/temirov/GAuss/pkg/constants"
-	"github.com/temirov/GAuss/pkg/session"
+	"github.com/temirov/GAuss/pkg/gauss"
 	"html/template"
 	"net/http"
 )
@@ -13,8 +13,9 @@ type Handlers struct {
 }
 
 // NewHandlers returns a handler set for serving the dashboard.
-// The service is used to obtain user information from the session and the
-// provided templates are executed when rendering the dashboard page.
+// The service is used to obtain user information for the logged-in user and
+// the provided templates are executed when rendering the dashboard page.
+// The dashboard must be wrapped with GAuss's AuthMiddleware.
 func NewHandlers(service *Service, templates *template.Template) *Handlers {
 	return &Handlers{
 		service:   service,
@@ -22,10 +23,15 @@ func NewHandlers(service *Service, templates *template.Template) *Handlers {
 	}
 }
 
-// Dashboard renders the dashboard.html template using data from the session.
+// Dashboard renders the dashboard.html template using data of the user that
+// AuthMiddleware attached to the request.
 func (handlers *Handlers) Dashboard(w http.ResponseWriter, r *http.Request) {
-	webSession, _ := session.Store().Get(r, constants.SessionName)
-	data := handlers.service.GetUserData(webSession)
+	googleUser, err := gauss.CurrentUser(r)
+	if err != nil {
+		http.Redirect(w, r, constants.LoginPath, http.StatusFound)
+		return
+	}
+	data := handlers.service.GetUserData(googleUser)
 	handlers.templates.ExecuteTemplate(w, "dashboard.html", data)
 }
 
@@ -1,8 +1,7 @@
 package dash
 
 import (
-	"github.com/gorilla/sessions"
-	"github.com/temirov/GAuss/pkg/constants"
+	"github.com/temirov/GAuss/pkg/gauss"
 )
 
 type Service struct {
@@ -16,12 +15,12 @@ func NewService() *Service {
 	return &Service{}
 }
 
-// GetUserData extracts a minimal set of user profile fields from the current
-// session and returns them in a map that matches the dashboard template.
-func (s *Service) GetUserData(session *sessions.Session) map[string]interface{} {
+// GetUserData extracts a minimal set of user profile fields from the logged-in
+// user and returns them in a map that matches the dashboard template.
+func (s *Service) GetUserData(googleUser *gauss.GoogleUser) map[string]interface{} {
 	return map[string]interface{}{
-		"Name":    session.Values[constants.SessionKeyUserName],
-		"Email":   session.Values[constants.SessionKeyUserEmail],
-		"Picture": session.Values[constants.SessionKeyUserPicture],
+		"Name":    googleUser.Name,
+		"Email":   googleUser.Email,
+		"Picture": googleUser.Picture,
 	}
 }
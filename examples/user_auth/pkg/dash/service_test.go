@@ -3,19 +3,17 @@ package dash
 import (
 	"testing"
 
-	"github.com/gorilla/sessions"
-	"github.com/temirov/GAuss/pkg/constants"
+	"github.com/temirov/GAuss/pkg/gauss"
 )
 
 func TestGetUserData(t *testing.T) {
 	svc := NewService()
-	sess := sessions.NewSession(&sessions.CookieStore{}, constants.SessionName)
-	sess.Values = map[interface{}]interface{}{
-		constants.SessionKeyUserEmail:   "e@example.com",
-		constants.SessionKeyUserName:    "tester",
-		constants.SessionKeyUserPicture: "pic",
+	googleUser := &gauss.GoogleUser{
+		Email:   "e@example.com",
+		Name:    "tester",
+		Picture: "pic",
 	}
-	data := svc.GetUserData(sess)
+	data := svc.GetUserData(googleUser)
 	if data["Email"] != "e@example.com" || data["Name"] != "tester" || data["Picture"] != "pic" {
 		t.Fatalf("unexpected data: %+v", data)
 	}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"html/template"
 	"log"
@@ -9,11 +8,9 @@ import (
 	"strings"
 	"time"
 
-	"github.com/temirov/GAuss/pkg/constants"
 	"github.com/temirov/GAuss/pkg/gauss"
 	"github.com/temirov/GAuss/pkg/session"
 	"github.com/temirov/utils/system"
-	"golang.org/x/oauth2"
 	"google.golang.org/api/option"
 	"google.golang.org/api/youtube/v3"
 )
@@ -32,10 +29,16 @@ func main() {
 	googleClientID := system.GetEnvOrFail("GOOGLE_CLIENT_ID")
 	googleClientSecret := system.GetEnvOrFail("GOOGLE_CLIENT_SECRET")
 
-	session.NewSession([]byte(clientSecret))
+	sessionStore := session.NewCookieStore([]byte(clientSecret))
 
 	scopes := gauss.ScopeStrings([]gauss.Scope{gauss.ScopeProfile, gauss.ScopeEmail, gauss.ScopeYouTubeReadonly})
-	authService, err := gauss.NewService(googleClientID, googleClientSecret, baseURL, mainPagePath, scopes, *loginTemplateFlag)
+	authService, err := gauss.New(googleClientID, googleClientSecret,
+		gauss.WithBaseURL(baseURL),
+		gauss.WithPostLoginURL(mainPagePath),
+		gauss.WithScopes(scopes...),
+		gauss.WithLoginTemplate(*loginTemplateFlag),
+		gauss.WithSessionStore(sessionStore),
+	)
 	if err != nil {
 		log.Fatalf("Failed to initialize auth service: %v", err)
 	}
@@ -53,11 +56,11 @@ func main() {
 		log.Fatalf("Failed to parse templates: %v", err)
 	}
 
-	mux.Handle(mainPagePath, requestLogger(gauss.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		renderYouTube(w, r, authService, templates)
+	mux.Handle(mainPagePath, requestLogger(authHandlers.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renderYouTube(w, r, authHandlers, templates)
 	}))))
 
-	mux.Handle(Root, gauss.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle(Root, authHandlers.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, mainPagePath, http.StatusFound)
 	})))
 
@@ -76,40 +79,23 @@ func requestLogger(next http.Handler) http.Handler {
 	})
 }
 
-func renderYouTube(w http.ResponseWriter, r *http.Request, svc *gauss.Service, tmpl *template.Template) {
+func renderYouTube(w http.ResponseWriter, r *http.Request, authHandlers *gauss.Handlers, tmpl *template.Template) {
 	log.Printf("YouTube render started: user_agent=%s", r.UserAgent())
 
-	sess, err := session.Store().Get(r, constants.SessionName)
+	// The client refreshes an expired access token and stores the new token in
+	// the session, so it has to be created before the response is written.
+	httpClient, err := authHandlers.Client(w, r)
 	if err != nil {
-		log.Printf("Session get failed: %v", err)
-		http.Error(w, "Session error", http.StatusInternalServerError)
-		return
-	}
-
-	tokJSON, ok := sess.Values[constants.SessionKeyOAuthToken].(string)
-	if !ok {
-		log.Printf("OAuth token missing from session: session_id=%s", sess.ID)
+		log.Printf("Authorized client unavailable: %v is_oauth_error=%v", err, isOAuthError(err))
+		if isOAuthError(err) {
+			log.Printf("OAuth error detected, redirecting to logout")
+			http.Redirect(w, r, "/logout", http.StatusFound)
+			return
+		}
 		http.Error(w, "Authentication required", http.StatusUnauthorized)
 		return
 	}
 
-	var token oauth2.Token
-	if err := json.Unmarshal([]byte(tokJSON), &token); err != nil {
-		log.Printf("Token unmarshal failed: %v", err)
-		http.Error(w, "Invalid authentication token", http.StatusInternalServerError)
-		return
-	}
-
-	log.Printf("Token details: has_access_token=%v has_refresh_token=%v is_expired=%v",
-		token.AccessToken != "", token.RefreshToken != "", token.Expiry.Before(time.Now()))
-
-	if token.AccessToken == "" {
-		log.Printf("Empty access token")
-		http.Error(w, "Invalid access token", http.StatusUnauthorized)
-		return
-	}
-
-	httpClient := svc.GetClient(r.Context(), &token)
 	ytService, err := youtube.NewService(r.Context(), option.WithHTTPClient(httpClient))
 	if err != nil {
 		log.Printf("YouTube service creation failed: %v", err)
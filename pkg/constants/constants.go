@@ -16,14 +16,46 @@ const (
 	// DefaultTemplateName is the embedded login template name.
 	DefaultTemplateName = "login.html"
 
+	// SessionKeyUserSubject stores the immutable Google account ID ("sub").
+	SessionKeyUserSubject = "user_sub"
 	// SessionKeyUserEmail stores the logged-in user's email in the session.
 	SessionKeyUserEmail = "user_email"
+	// SessionKeyUserEmailVerified stores whether Google verified the email.
+	SessionKeyUserEmailVerified = "user_email_verified"
 	// SessionKeyUserName stores the logged-in user's display name.
 	SessionKeyUserName = "user_name"
+	// SessionKeyUserGivenName stores the user's given name.
+	SessionKeyUserGivenName = "user_given_name"
+	// SessionKeyUserFamilyName stores the user's family name.
+	SessionKeyUserFamilyName = "user_family_name"
 	// SessionKeyUserPicture stores the profile image URL.
 	SessionKeyUserPicture = "user_picture"
+	// SessionKeyUserLocale stores the user's preferred locale.
+	SessionKeyUserLocale = "user_locale"
+	// SessionKeyUserHostedDomain stores the Google Workspace domain ("hd").
+	SessionKeyUserHostedDomain = "user_hosted_domain"
+	// SessionKeyUserRoles caches the user's roles ([]string).
+	SessionKeyUserRoles = "user_roles"
+	// SessionKeyUserRolesResolvedAt stores when the cached roles were resolved
+	// (Unix seconds).
+	SessionKeyUserRolesResolvedAt = "user_roles_resolved_at"
 	// SessionKeyOAuthToken stores the OAuth2 token JSON string.
 	SessionKeyOAuthToken = "oauth_token"
+	// SessionKeyOAuthState stores the state value of an in-flight login.
+	SessionKeyOAuthState = "oauth_state"
+	// SessionKeyCodeVerifier stores the PKCE code verifier of an in-flight login.
+	SessionKeyCodeVerifier = "oauth_code_verifier"
+	// SessionKeyOIDCNonce stores the OpenID Connect nonce of an in-flight login.
+	SessionKeyOIDCNonce = "oauth_nonce"
+	// SessionKeyReturnTo stores the local URL to return to after login.
+	SessionKeyReturnTo = "oauth_return_to"
+	// SessionKeyConsentRequested marks a login restarted with prompt=consent to
+	// obtain a refresh token. It holds the state of that authorization request,
+	// so it only applies to the callback completing it.
+	SessionKeyConsentRequested = "oauth_consent_requested"
+	// SessionKeyProvider stores the Name of the provider the user logged in
+	// with.
+	SessionKeyProvider = "auth_provider"
 
 	// SessionName is the cookie name used for sessions.
 	SessionName = "gauss_session"
@@ -0,0 +1,67 @@
+package gauss
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// AuthenticateChallenge is the WWW-Authenticate header sent with 401
+// responses to API clients.
+const AuthenticateChallenge = `Bearer realm="GAuss"`
+
+// apiErrorResponse is the JSON body of error responses sent to API clients.
+type apiErrorResponse struct {
+	Error    string `json:"error"`
+	Message  string `json:"message"`
+	LoginURL string `json:"login_url,omitempty"`
+}
+
+// writeJSONError writes an apiErrorResponse with statusCode.
+func writeJSONError(responseWriter http.ResponseWriter, statusCode int, body apiErrorResponse) {
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.Header().Set("Cache-Control", "no-store")
+	responseWriter.WriteHeader(statusCode)
+	json.NewEncoder(responseWriter).Encode(body)
+}
+
+// wantsJSON reports whether the client prefers a JSON response, i.e. it
+// accepts application/json but not text/html.
+func wantsJSON(request *http.Request) bool {
+	accept := request.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// isHTMXRequest reports whether request was issued by HTMX, which follows
+// HX-Redirect headers instead of swapping redirected pages into the document.
+func isHTMXRequest(request *http.Request) bool {
+	return request.Header.Get("HX-Request") == "true"
+}
+
+// isAPIRequest reports whether request comes from a script rather than a
+// browser navigation: it prefers JSON, was sent with X-Requested-With, or
+// targets one of apiPathPrefixes.
+func isAPIRequest(request *http.Request, apiPathPrefixes []string) bool {
+	if wantsJSON(request) || request.Header.Get("X-Requested-With") != "" {
+		return true
+	}
+	for _, prefix := range apiPathPrefixes {
+		if request.URL.Path == prefix || strings.HasPrefix(request.URL.Path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePathPrefixes cleans the prefixes given to WithAPIPathPrefix so that
+// "/api/" and "api" both match "/api" and everything below it.
+func normalizePathPrefixes(prefixes []string) []string {
+	var normalizedPrefixes []string
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+		if prefix != "" {
+			normalizedPrefixes = append(normalizedPrefixes, "/"+prefix)
+		}
+	}
+	return normalizedPrefixes
+}
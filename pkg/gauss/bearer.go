@@ -0,0 +1,293 @@
+package gauss
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// GoogleTokenInfoURL is Google's endpoint for validating access tokens.
+const GoogleTokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+const (
+	// bearerCacheDuration bounds how long a validated bearer token is trusted
+	// before it is validated again.
+	bearerCacheDuration = 5 * time.Minute
+	// bearerCacheLimit caps the number of validated bearer tokens kept.
+	bearerCacheLimit = 10000
+)
+
+// ErrInvalidBearerToken is returned for bearer tokens that are malformed,
+// expired, issued to another client or rejected by the provider.
+var ErrInvalidBearerToken = errors.New("gauss: invalid bearer token")
+
+// bearerEntry is a validated bearer token.
+type bearerEntry struct {
+	identity  *requestIdentity
+	expiresAt time.Time
+}
+
+// bearerCache remembers validated bearer tokens, keyed by their SHA-256 hash so
+// the raw tokens are not kept in memory, until they expire.
+type bearerCache struct {
+	mutex   sync.Mutex
+	entries map[[sha256.Size]byte]bearerEntry
+}
+
+func newBearerCache() *bearerCache {
+	return &bearerCache{entries: make(map[[sha256.Size]byte]bearerEntry)}
+}
+
+// get returns the identity cached for rawToken while it is fresh.
+func (cacheInstance *bearerCache) get(rawToken string) (*requestIdentity, bool) {
+	cacheInstance.mutex.Lock()
+	defer cacheInstance.mutex.Unlock()
+
+	tokenHash := sha256.Sum256([]byte(rawToken))
+	entry, found := cacheInstance.entries[tokenHash]
+	if !found {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(cacheInstance.entries, tokenHash)
+		return nil, false
+	}
+	return entry.identity, true
+}
+
+// put caches identity for rawToken until expiresAt. When the cache is full,
+// expired entries are dropped, and if that frees nothing the cache starts
+// over.
+func (cacheInstance *bearerCache) put(rawToken string, identity *requestIdentity, expiresAt time.Time) {
+	cacheInstance.mutex.Lock()
+	defer cacheInstance.mutex.Unlock()
+
+	if len(cacheInstance.entries) >= bearerCacheLimit {
+		now := time.Now()
+		for tokenHash, entry := range cacheInstance.entries {
+			if now.After(entry.expiresAt) {
+				delete(cacheInstance.entries, tokenHash)
+			}
+		}
+		if len(cacheInstance.entries) >= bearerCacheLimit {
+			clear(cacheInstance.entries)
+		}
+	}
+	cacheInstance.entries[sha256.Sum256([]byte(rawToken))] = bearerEntry{identity: identity, expiresAt: expiresAt}
+}
+
+// VerifyBearerToken validates a token presented in an Authorization: Bearer
+// header and returns its user. Tokens shaped like a JWT are verified as Google
+// ID tokens against the cached signing keys; other tokens are treated as
+// access tokens and checked at the tokeninfo endpoint. Either kind must have
+// been issued to the Service's client ID or to one added with
+// WithBearerAudiences. Results are cached until the token expires, for at most
+// five minutes. Invalid tokens yield an error wrapping ErrInvalidBearerToken.
+func (serviceInstance *Service) VerifyBearerToken(ctx context.Context, rawToken string) (*GoogleUser, error) {
+	identity, verifyError := serviceInstance.bearerIdentity(ctx, rawToken)
+	if verifyError != nil {
+		return nil, verifyError
+	}
+	return identity.user, nil
+}
+
+// bearerIdentity returns the identity of rawToken, including the user's roles
+// when a RoleResolver is configured, from the cache or by validating it.
+func (serviceInstance *Service) bearerIdentity(ctx context.Context, rawToken string) (*requestIdentity, error) {
+	if identity, found := serviceInstance.bearerTokens.get(rawToken); found {
+		return identity, nil
+	}
+
+	var identity *requestIdentity
+	var tokenExpiry time.Time
+	if strings.Count(rawToken, ".") == 2 {
+		claims, verifyError := serviceInstance.verifier().verifyForAudiences(ctx, rawToken, "", serviceInstance.bearerAudiences)
+		if verifyError != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBearerToken, verifyError)
+		}
+		claimsUser, mapError := serviceInstance.userFromClaims(claims)
+		if mapError != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBearerToken, mapError)
+		}
+		identity = &requestIdentity{user: claimsUser, provider: serviceInstance.provider.Name(), tokenError: ErrTokenMissing}
+		tokenExpiry = time.Unix(claims.ExpiresAt, 0)
+	} else {
+		googleUser, expiry, validateError := serviceInstance.validateAccessToken(ctx, rawToken)
+		if validateError != nil {
+			return nil, validateError
+		}
+		accessToken := &oauth2.Token{AccessToken: rawToken, TokenType: "Bearer", Expiry: expiry}
+		if len(serviceInstance.allowedHostedDomains) > 0 {
+			// tokeninfo omits the hd claim, so the restriction reads it from
+			// the userinfo endpoint.
+			profile, profileError := serviceInstance.fetchUser(ctx, accessToken)
+			if profileError != nil {
+				return nil, fmt.Errorf("failed to read the hosted domain of an access token: %w", profileError)
+			}
+			if profile.Subject != googleUser.Subject {
+				return nil, fmt.Errorf("%w: userinfo names another user than tokeninfo", ErrInvalidBearerToken)
+			}
+			googleUser.HostedDomain = profile.HostedDomain
+		}
+		identity = &requestIdentity{user: googleUser, provider: serviceInstance.provider.Name(), token: accessToken}
+		tokenExpiry = expiry
+	}
+
+	cacheUntil := time.Now().Add(bearerCacheDuration)
+	if serviceInstance.roleResolver != nil {
+		roles, resolveError := serviceInstance.roleResolver.ResolveRoles(ctx, identity.user)
+		if resolveError != nil {
+			return nil, fmt.Errorf("failed to resolve roles: %w", resolveError)
+		}
+		identity.roles = roles
+		if rolesStaleAt := time.Now().Add(serviceInstance.roleCacheDuration); rolesStaleAt.Before(cacheUntil) {
+			cacheUntil = rolesStaleAt
+		}
+	}
+	if tokenExpiry.Before(cacheUntil) {
+		cacheUntil = tokenExpiry
+	}
+	serviceInstance.bearerTokens.put(rawToken, identity, cacheUntil)
+	return identity, nil
+}
+
+// validateAccessToken checks rawToken at the tokeninfo endpoint and returns the
+// user it was issued for and its expiry. Tokens need the openid or email scope
+// for tokeninfo to name the user.
+func (serviceInstance *Service) validateAccessToken(ctx context.Context, rawToken string) (*GoogleUser, time.Time, error) {
+	tokenInfoURL := serviceInstance.tokenInfoEndpoint()
+	if tokenInfoURL == "" {
+		return nil, time.Time{}, fmt.Errorf("%w: provider %q cannot validate access tokens", ErrInvalidBearerToken, serviceInstance.provider.Name())
+	}
+	form := url.Values{"access_token": {rawToken}}
+	httpRequest, requestError := http.NewRequestWithContext(ctx, http.MethodPost, tokenInfoURL, strings.NewReader(form.Encode()))
+	if requestError != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to build tokeninfo request: %w", requestError)
+	}
+	httpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	httpResponse, httpError := serviceInstance.providerClient().Do(httpRequest)
+	if httpError != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to validate access token: %w", httpError)
+	}
+	defer httpResponse.Body.Close()
+
+	switch {
+	case httpResponse.StatusCode == http.StatusBadRequest || httpResponse.StatusCode == http.StatusUnauthorized:
+		return nil, time.Time{}, fmt.Errorf("%w: rejected by tokeninfo endpoint", ErrInvalidBearerToken)
+	case httpResponse.StatusCode != http.StatusOK:
+		return nil, time.Time{}, fmt.Errorf("tokeninfo endpoint returned status %d", httpResponse.StatusCode)
+	}
+
+	// Google encodes the numbers and booleans of tokeninfo responses as strings.
+	var tokenInfo struct {
+		Audience        string `json:"aud"`
+		AuthorizedParty string `json:"azp"`
+		Subject         string `json:"sub"`
+		Email           string `json:"email"`
+		EmailVerified   string `json:"email_verified"`
+		ExpiresAt       string `json:"exp"`
+	}
+	if decodeError := json.NewDecoder(httpResponse.Body).Decode(&tokenInfo); decodeError != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to decode tokeninfo response: %w", decodeError)
+	}
+
+	if !slices.Contains(serviceInstance.bearerAudiences, tokenInfo.Audience) && !slices.Contains(serviceInstance.bearerAudiences, tokenInfo.AuthorizedParty) {
+		return nil, time.Time{}, fmt.Errorf("%w: access token was not issued for this client", ErrInvalidBearerToken)
+	}
+	expiresAt, expiryError := strconv.ParseInt(tokenInfo.ExpiresAt, 10, 64)
+	if expiryError != nil || time.Now().After(time.Unix(expiresAt, 0)) {
+		return nil, time.Time{}, fmt.Errorf("%w: access token has expired", ErrInvalidBearerToken)
+	}
+	if tokenInfo.Subject == "" {
+		return nil, time.Time{}, fmt.Errorf("%w: access token does not identify a user", ErrInvalidBearerToken)
+	}
+
+	googleUser := &GoogleUser{
+		Subject:       tokenInfo.Subject,
+		Email:         tokenInfo.Email,
+		EmailVerified: tokenInfo.EmailVerified == "true",
+	}
+	return googleUser, time.Unix(expiresAt, 0), nil
+}
+
+// bearerTokenFromRequest returns the token of an Authorization: Bearer header.
+func bearerTokenFromRequest(request *http.Request) (string, bool) {
+	scheme, rawToken, found := strings.Cut(request.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	rawToken = strings.TrimSpace(rawToken)
+	return rawToken, rawToken != ""
+}
+
+// BearerMiddleware authenticates API requests by the Google ID token or access
+// token in their Authorization: Bearer header, as described for
+// VerifyBearerToken, instead of by a session cookie. Hosted domain
+// restrictions and the authorization policy apply as for sessions, and the
+// user, roles and, for access tokens, the token are attached to the request
+// context for CurrentUser, CurrentRoles and TokenFromRequest. Requests without
+// a valid token receive 401 with a JSON body and a WWW-Authenticate challenge.
+func (handlersInstance *Handlers) BearerMiddleware(nextHandler http.Handler) http.Handler {
+	serviceInstance := handlersInstance.service
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		rawToken, found := bearerTokenFromRequest(request)
+		if !found {
+			responseWriter.Header().Set("WWW-Authenticate", AuthenticateChallenge)
+			writeJSONError(responseWriter, http.StatusUnauthorized, apiErrorResponse{
+				Error:   "unauthenticated",
+				Message: "A bearer token is required.",
+			})
+			return
+		}
+
+		identity, identityError := serviceInstance.bearerIdentity(request.Context(), rawToken)
+		switch {
+		case errors.Is(identityError, ErrInvalidBearerToken):
+			requestLogger(serviceInstance.logger, request).Warn("Rejected bearer token", "event", "bearer_rejected", "error_code", "invalid_token", "error", identityError)
+			responseWriter.Header().Set("WWW-Authenticate", AuthenticateChallenge+`, error="invalid_token"`)
+			writeJSONError(responseWriter, http.StatusUnauthorized, apiErrorResponse{
+				Error:   "invalid_token",
+				Message: "The bearer token is invalid or has expired.",
+			})
+			return
+		case identityError != nil:
+			requestLogger(serviceInstance.logger, request).Error("Failed to validate bearer token", "error", identityError)
+			writeJSONError(responseWriter, http.StatusInternalServerError, apiErrorResponse{
+				Error:   "server_error",
+				Message: "The bearer token could not be validated.",
+			})
+			return
+		}
+
+		authorized, authorizeError := serviceInstance.authorize(request.Context(), identity.user)
+		if authorizeError != nil {
+			requestLogger(serviceInstance.logger, request).Error("Failed to evaluate authorization policy", "sub", identity.user.Subject, "error", authorizeError)
+			writeJSONError(responseWriter, http.StatusInternalServerError, apiErrorResponse{
+				Error:   "server_error",
+				Message: "The authorization policy could not be evaluated.",
+			})
+			return
+		}
+		if !authorized || !serviceInstance.allowsHostedDomain(identity.user) {
+			requestLogger(serviceInstance.logger, request).Warn("Bearer token rejected by authorization policy", "event", "bearer_rejected", "error_code", "forbidden", "sub", identity.user.Subject)
+			writeJSONError(responseWriter, http.StatusForbidden, apiErrorResponse{
+				Error:   "forbidden",
+				Message: "You are not allowed to use this application.",
+			})
+			return
+		}
+		nextHandler.ServeHTTP(responseWriter, request.WithContext(contextWithIdentity(request.Context(), identity)))
+	})
+}
@@ -0,0 +1,99 @@
+package gauss
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveBearer runs the request through BearerMiddleware and returns the
+// response together with the user that reached the handler.
+func serveBearer(t *testing.T, h *Handlers, authorization string) (*httptest.ResponseRecorder, *GoogleUser) {
+	t.Helper()
+	var reachedUser *GoogleUser
+	protected := h.BearerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := CurrentUser(r)
+		if err != nil {
+			t.Errorf("CurrentUser: %v", err)
+		}
+		reachedUser = user
+	}))
+	req := httptest.NewRequest("GET", "/api/me", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rr := httptest.NewRecorder()
+	protected.ServeHTTP(rr, req)
+	return rr, reachedUser
+}
+
+func TestBearerMiddlewareIDToken(t *testing.T) {
+	signer := newTestSigner(t)
+	h := newServiceHandlers(t, WithBearerAudiences("android-client"))
+
+	for _, audience := range []string{"id", "android-client"} {
+		claims := validClaims()
+		claims["aud"] = audience
+		rr, user := serveBearer(t, h, "Bearer "+signer.sign(t, claims))
+		if rr.Code != http.StatusOK || user == nil || user.Email != "e@example.com" {
+			t.Fatalf("token for %q was rejected: %d %s", audience, rr.Code, rr.Body.String())
+		}
+	}
+
+	claims := validClaims()
+	claims["aud"] = "someone-else"
+	rr, _ := serveBearer(t, h, "Bearer "+signer.sign(t, claims))
+	if rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+		t.Fatalf("expected invalid_token for a foreign audience, got %d %v", rr.Code, rr.Header())
+	}
+
+	rr, _ = serveBearer(t, h, "")
+	var body apiErrorResponse
+	if rr.Code != http.StatusUnauthorized || json.Unmarshal(rr.Body.Bytes(), &body) != nil || body.Error != "unauthenticated" {
+		t.Fatalf("expected 401 without a token, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestBearerMiddlewareAccessToken(t *testing.T) {
+	provider := newFakeProvider(t, map[string]interface{}{"sub": "7", "email": "api@example.com", "email_verified": true})
+	provider.acceptAccessToken("ya29.good", "id")
+	provider.acceptAccessToken("ya29.foreign", "someone-else")
+	h := newProviderHandlers(t, provider)
+
+	for range 2 {
+		protected := h.BearerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := CurrentUser(r)
+			token, err := TokenFromRequest(r)
+			if user.Subject != "7" || !user.EmailVerified || err != nil || token.AccessToken != "ya29.good" {
+				t.Errorf("unexpected identity %+v %v %v", user, token, err)
+			}
+		}))
+		req := httptest.NewRequest("GET", "/api/me", nil)
+		req.Header.Set("Authorization", "Bearer ya29.good")
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("valid access token was rejected: %d", rr.Code)
+		}
+	}
+	if got := provider.tokenInfoRequests.Load(); got != 1 {
+		t.Fatalf("expected the validation to be cached, tokeninfo was called %d times", got)
+	}
+
+	for _, rawToken := range []string{"ya29.foreign", "ya29.revoked"} {
+		if rr, _ := serveBearer(t, h, "Bearer "+rawToken); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected 401, got %d", rawToken, rr.Code)
+		}
+	}
+}
+
+func TestBearerMiddlewareAppliesPolicy(t *testing.T) {
+	signer := newTestSigner(t)
+	h := newServiceHandlers(t, WithAuthorizationPolicy(NewListPolicy([]string{"*@example.org"}, nil)))
+	rr, _ := serveBearer(t, h, "Bearer "+signer.sign(t, validClaims()))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a user outside the policy, got %d", rr.Code)
+	}
+}
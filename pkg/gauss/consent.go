@@ -0,0 +1,63 @@
+package gauss
+
+import (
+	"context"
+
+	"github.com/gorilla/sessions"
+	"github.com/temirov/GAuss/pkg/constants"
+)
+
+// maxProviderErrorLength caps error codes copied from the provider's redirect.
+const maxProviderErrorLength = 64
+
+// authorizationParameters returns the access_type and prompt values for a new
+// login. consentRequested is true when Callback restarted the login because a
+// refresh token was needed.
+func (serviceInstance *Service) authorizationParameters(consentRequested bool) (string, Prompt) {
+	if serviceInstance.accessType != AccessTypeOfflineIfNeeded {
+		return string(serviceInstance.accessType), serviceInstance.prompt
+	}
+	if consentRequested {
+		return string(AccessTypeOffline), PromptConsent
+	}
+	return string(AccessTypeOffline), serviceInstance.prompt
+}
+
+// heldRefreshToken returns a refresh token GAuss or the application already
+// holds for googleUser: the one in the session of a previous login by the same
+// user, or the one returned by the configured RefreshTokenLookup.
+func (serviceInstance *Service) heldRefreshToken(ctx context.Context, webSession *sessions.Session, googleUser *GoogleUser) (string, error) {
+	if googleUser != nil && googleUser.Subject != "" {
+		previousSubject, _ := webSession.Values[constants.SessionKeyUserSubject].(string)
+		if previousToken, tokenError := tokenFromSession(webSession); tokenError == nil && previousSubject == googleUser.Subject {
+			if previousToken.RefreshToken != "" {
+				return previousToken.RefreshToken, nil
+			}
+		}
+	}
+	if serviceInstance.refreshTokenLookup == nil {
+		return "", nil
+	}
+	return serviceInstance.refreshTokenLookup(ctx, googleUser)
+}
+
+// providerErrorCode turns the error parameter of a provider redirect, such as
+// "access_denied" or "login_required", into a code that is safe to echo on the
+// login page.
+func providerErrorCode(rawError string) string {
+	return safeErrorCode(rawError, "provider_error")
+}
+
+// safeErrorCode returns rawCode when it only contains lowercase letters and
+// underscores, and fallback otherwise.
+func safeErrorCode(rawCode string, fallback string) string {
+	if rawCode == "" || len(rawCode) > maxProviderErrorLength {
+		return fallback
+	}
+	for _, character := range rawCode {
+		if (character < 'a' || character > 'z') && character != '_' {
+			return fallback
+		}
+	}
+	return rawCode
+}
@@ -0,0 +1,42 @@
+package gauss
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/temirov/GAuss/pkg/constants"
+)
+
+func TestAuthorizationParameters(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	testCases := []struct {
+		name       string
+		options    []Option
+		accessType string
+		prompt     string
+	}{
+		{"default", nil, "offline", "consent"},
+		{"online", []Option{WithAccessType(AccessTypeOnline)}, "online", ""},
+		{"select account", []Option{WithPrompt(PromptSelectAccount)}, "offline", "select_account"},
+		{"silent online", []Option{WithAccessType(AccessTypeOnline), WithPrompt(PromptNone)}, "online", "none"},
+		{"offline if needed", []Option{WithAccessType(AccessTypeOfflineIfNeeded)}, "offline", ""},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			h := newProviderHandlers(t, provider, testCase.options...)
+			rr := httptest.NewRecorder()
+			h.Login(rr, httptest.NewRequest("GET", constants.GoogleAuthPath, nil))
+			authURL, err := url.Parse(rr.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := authURL.Query().Get("access_type"); got != testCase.accessType {
+				t.Errorf("access_type = %q, want %q", got, testCase.accessType)
+			}
+			if got := authURL.Query().Get("prompt"); got != testCase.prompt {
+				t.Errorf("prompt = %q, want %q", got, testCase.prompt)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package gauss
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// discoveryPath is where OpenID Connect issuers publish their configuration.
+const discoveryPath = "/.well-known/openid-configuration"
+
+// discoveryDocument holds the fields of an OpenID Connect discovery document
+// GAuss uses.
+type discoveryDocument struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserInfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	RevocationEndpoint    string   `json:"revocation_endpoint"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// newDiscoveryDocument returns the cached discovery document of issuerURL.
+// Documents that name another issuer or lack a required endpoint are rejected
+// like failed fetches, so a broken refetch keeps the previous document.
+func newDiscoveryDocument(issuerURL string, httpClient *http.Client) *cachedDocument[discoveryDocument] {
+	discoveryURL := strings.TrimSuffix(issuerURL, "/") + discoveryPath
+	return newCachedDocument(discoveryURL, httpClient, func(body io.Reader) (discoveryDocument, error) {
+		var document discoveryDocument
+		if decodeError := json.NewDecoder(body).Decode(&document); decodeError != nil {
+			return discoveryDocument{}, decodeError
+		}
+		if document.Issuer != issuerURL {
+			return discoveryDocument{}, fmt.Errorf("discovery document names issuer %q instead of %q", document.Issuer, issuerURL)
+		}
+		if document.AuthorizationEndpoint == "" || document.TokenEndpoint == "" || document.JWKSURI == "" {
+			return discoveryDocument{}, errors.New("discovery document lacks the authorization, token or JWKS endpoint")
+		}
+		return document, nil
+	})
+}
+
+// endpoints returns the endpoints listed in the document.
+func (document discoveryDocument) endpoints() Endpoints {
+	return Endpoints{
+		AuthURL:       document.AuthorizationEndpoint,
+		TokenURL:      document.TokenEndpoint,
+		UserInfoURL:   document.UserInfoEndpoint,
+		JWKSURL:       document.JWKSURI,
+		RevocationURL: document.RevocationEndpoint,
+		Issuer:        document.Issuer,
+		AuthStyle:     tokenAuthStyle(document.TokenAuthMethods),
+	}
+}
@@ -1,13 +1,18 @@
 // Package gauss implements Google OAuth2 authentication and session management.
 //
 // It exposes a Service type that configures the OAuth2 client, generates state
-// parameters, and retrieves user information from Google. Handlers provides a
+// parameters, and retrieves user information from Google, either through the
+// userinfo endpoint or, when the "openid" scope is requested, from a verified
+// OpenID Connect ID token. Handlers provides a
 // ready-to-use set of HTTP handlers that mount the login, callback, and logout
 // routes on a ServeMux. The package also offers AuthMiddleware to protect
-// application endpoints by ensuring a valid GAuss session is present.
+// application endpoints by ensuring a valid GAuss session is present. Sessions
+// live in the store injected into the Service, so independent services can
+// coexist in one process.
 //
 // Applications can embed this package to replace custom Google authentication
-// flows. Initialize a Service with your OAuth credentials, create Handlers, and
-// register the routes with your own mux. Protected routes should be wrapped with
-// AuthMiddleware to require a logged in user.
+// flows. Create a Service with New, passing your OAuth credentials and Options
+// such as WithBaseURL and WithScopes, create Handlers, and register the routes
+// with your own mux. Protected routes should be wrapped with
+// Handlers.AuthMiddleware to require a logged in user.
 package gauss
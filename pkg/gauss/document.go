@@ -0,0 +1,190 @@
+package gauss
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultDocumentLifetime is how long a document is cached when its
+	// response carries no max-age.
+	defaultDocumentLifetime = time.Hour
+	// minDocumentLifetime keeps documents served with no-cache, no-store or a
+	// tiny max-age from being fetched on every use.
+	minDocumentLifetime = time.Minute
+	// maxDocumentLifetime bounds how long a document is trusted.
+	maxDocumentLifetime = 24 * time.Hour
+	// documentFetchTimeout bounds a shared fetch, which outlives the context
+	// of the caller that started it.
+	documentFetchTimeout = 30 * time.Second
+)
+
+// cacheLifetime returns how long a response may be reused according to its
+// Cache-Control max-age and Age headers, clamped to the document lifetime
+// bounds.
+func cacheLifetime(header http.Header) time.Duration {
+	lifetime := defaultDocumentLifetime
+	for _, directive := range strings.Split(strings.ToLower(header.Get("Cache-Control")), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch name {
+		case "no-cache", "no-store":
+			return minDocumentLifetime
+		case "max-age":
+			if seconds, parseError := strconv.Atoi(strings.Trim(value, `"`)); parseError == nil {
+				lifetime = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	if age, parseError := strconv.Atoi(header.Get("Age")); parseError == nil && age > 0 {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	return min(max(lifetime, minDocumentLifetime), maxDocumentLifetime)
+}
+
+// documentFetch is a fetch of a cachedDocument that concurrent callers wait
+// for together.
+type documentFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// cachedDocument fetches a JSON document, such as a JWKS or an OpenID Connect
+// discovery document, and caches its decoded value for as long as the
+// response's Cache-Control header allows. Concurrent callers share a single
+// fetch. When a refetch fails, the stale value keeps being served and the next
+// attempt is made after minDocumentLifetime. It is safe for concurrent use.
+type cachedDocument[T any] struct {
+	url        string
+	httpClient *http.Client
+	decode     func(body io.Reader) (T, error)
+
+	mutex     sync.Mutex
+	value     T
+	loaded    bool
+	fetchedAt time.Time
+	expiresAt time.Time
+	inflight  *documentFetch
+}
+
+func newCachedDocument[T any](documentURL string, httpClient *http.Client, decode func(body io.Reader) (T, error)) *cachedDocument[T] {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &cachedDocument[T]{url: documentURL, httpClient: httpClient, decode: decode}
+}
+
+// get returns the cached value, fetching it when it is missing or stale.
+func (document *cachedDocument[T]) get(ctx context.Context) (T, error) {
+	return document.load(ctx, func(now time.Time) bool {
+		return !document.loaded || !now.Before(document.expiresAt)
+	})
+}
+
+// refresh refetches the document, e.g. because a JWKS lacks a newly rotated
+// key, unless it was fetched less than minInterval ago.
+func (document *cachedDocument[T]) refresh(ctx context.Context, minInterval time.Duration) (T, error) {
+	return document.load(ctx, func(now time.Time) bool {
+		return !document.loaded || now.Sub(document.fetchedAt) >= minInterval
+	})
+}
+
+// current returns the cached value without waiting for the network, starting
+// a background refetch when it is stale. It is meant for documents that were
+// loaded with get before, whose stale value is still usable.
+func (document *cachedDocument[T]) current() T {
+	document.mutex.Lock()
+	defer document.mutex.Unlock()
+	if document.inflight == nil && !time.Now().Before(document.expiresAt) {
+		fetch := &documentFetch{done: make(chan struct{})}
+		document.inflight = fetch
+		go document.fetch(context.Background(), fetch)
+	}
+	return document.value
+}
+
+// load returns the cached value after fetching it when stale reports so, or
+// after waiting for a fetch already in flight.
+func (document *cachedDocument[T]) load(ctx context.Context, stale func(now time.Time) bool) (T, error) {
+	document.mutex.Lock()
+	fetch := document.inflight
+	if fetch == nil {
+		if !stale(time.Now()) {
+			value := document.value
+			document.mutex.Unlock()
+			return value, nil
+		}
+		fetch = &documentFetch{done: make(chan struct{})}
+		document.inflight = fetch
+		go document.fetch(context.WithoutCancel(ctx), fetch)
+	}
+	document.mutex.Unlock()
+
+	select {
+	case <-fetch.done:
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+
+	document.mutex.Lock()
+	defer document.mutex.Unlock()
+	if !document.loaded {
+		var zero T
+		return zero, fetch.err
+	}
+	return document.value, nil
+}
+
+// fetch downloads and decodes the document, stores the result and completes
+// fetch.
+func (document *cachedDocument[T]) fetch(ctx context.Context, fetch *documentFetch) {
+	ctx, cancel := context.WithTimeout(ctx, documentFetchTimeout)
+	defer cancel()
+	value, lifetime, fetchError := fetchDocument(ctx, document.httpClient, document.url, document.decode)
+
+	document.mutex.Lock()
+	now := time.Now()
+	if fetchError == nil {
+		document.value = value
+		document.loaded = true
+		document.fetchedAt = now
+		document.expiresAt = now.Add(lifetime)
+	} else if document.loaded {
+		document.expiresAt = now.Add(minDocumentLifetime)
+	}
+	document.inflight = nil
+	fetch.err = fetchError
+	document.mutex.Unlock()
+	close(fetch.done)
+}
+
+// fetchDocument requests the JSON document at documentURL and returns its
+// decoded value and the lifetime its Cache-Control header allows.
+func fetchDocument[T any](ctx context.Context, httpClient *http.Client, documentURL string, decode func(body io.Reader) (T, error)) (T, time.Duration, error) {
+	var zero T
+	httpRequest, requestError := http.NewRequestWithContext(ctx, http.MethodGet, documentURL, nil)
+	if requestError != nil {
+		return zero, 0, fmt.Errorf("failed to build request for %s: %w", documentURL, requestError)
+	}
+	httpRequest.Header.Set("Accept", "application/json")
+	httpResponse, httpError := httpClient.Do(httpRequest)
+	if httpError != nil {
+		return zero, 0, fmt.Errorf("failed to fetch %s: %w", documentURL, httpError)
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		return zero, 0, fmt.Errorf("%s returned status %d", documentURL, httpResponse.StatusCode)
+	}
+	value, decodeError := decode(httpResponse.Body)
+	if decodeError != nil {
+		return zero, 0, fmt.Errorf("failed to decode %s: %w", documentURL, decodeError)
+	}
+	return value, cacheLifetime(httpResponse.Header), nil
+}
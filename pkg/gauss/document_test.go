@@ -0,0 +1,114 @@
+package gauss
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheLifetime(t *testing.T) {
+	testCases := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{name: "no header", header: http.Header{}, want: defaultDocumentLifetime},
+		{name: "max-age", header: http.Header{"Cache-Control": {"public, max-age=19845, must-revalidate"}}, want: 19845 * time.Second},
+		{name: "age subtracted", header: http.Header{"Cache-Control": {"max-age=3600"}, "Age": {"600"}}, want: 50 * time.Minute},
+		{name: "no-cache", header: http.Header{"Cache-Control": {"no-cache, max-age=3600"}}, want: minDocumentLifetime},
+		{name: "no-store", header: http.Header{"Cache-Control": {"No-Store"}}, want: minDocumentLifetime},
+		{name: "short max-age", header: http.Header{"Cache-Control": {"max-age=5"}}, want: minDocumentLifetime},
+		{name: "long max-age", header: http.Header{"Cache-Control": {"max-age=31536000"}}, want: maxDocumentLifetime},
+		{name: "invalid max-age", header: http.Header{"Cache-Control": {"max-age=soon"}}, want: defaultDocumentLifetime},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := cacheLifetime(testCase.header); got != testCase.want {
+				t.Fatalf("got %v, want %v", got, testCase.want)
+			}
+		})
+	}
+}
+
+// newCountingDocument serves a JSON number that increases with every request,
+// failing with status 500 while fail is set.
+func newCountingDocument(t *testing.T, cacheControl string, fail *atomic.Bool) (*cachedDocument[int], *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := requests.Add(1)
+		if fail != nil && fail.Load() {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", cacheControl)
+		time.Sleep(10 * time.Millisecond)
+		json.NewEncoder(w).Encode(count)
+	}))
+	t.Cleanup(server.Close)
+	decode := func(body io.Reader) (int, error) {
+		var value int
+		decodeError := json.NewDecoder(body).Decode(&value)
+		return value, decodeError
+	}
+	return newCachedDocument(server.URL, server.Client(), decode), &requests
+}
+
+func TestCachedDocumentSharesFetches(t *testing.T) {
+	document, requests := newCountingDocument(t, "max-age=600", nil)
+
+	var waitGroup sync.WaitGroup
+	for range 20 {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			if value, err := document.get(context.Background()); err != nil || value != 1 {
+				t.Errorf("got %d, %v", value, err)
+			}
+		}()
+	}
+	waitGroup.Wait()
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("expected concurrent callers to share one fetch, got %d", got)
+	}
+
+	if value, err := document.refresh(context.Background(), time.Minute); err != nil || value != 1 {
+		t.Fatalf("expected a rate limited refresh to use the cache, got %d, %v", value, err)
+	}
+	if value, err := document.refresh(context.Background(), 0); err != nil || value != 2 {
+		t.Fatalf("expected a refetch, got %d, %v", value, err)
+	}
+}
+
+func TestCachedDocumentExpiry(t *testing.T) {
+	var fail atomic.Bool
+	document, requests := newCountingDocument(t, "max-age=120", &fail)
+	if _, err := document.get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	document.mutex.Lock()
+	if lifetime := document.expiresAt.Sub(document.fetchedAt); lifetime != 2*time.Minute {
+		t.Errorf("expected the max-age to set the lifetime, got %v", lifetime)
+	}
+	document.expiresAt = time.Now()
+	document.mutex.Unlock()
+
+	fail.Store(true)
+	if value, err := document.get(context.Background()); err != nil || value != 1 {
+		t.Fatalf("expected the stale value when the refetch fails, got %d, %v", value, err)
+	}
+	if value, err := document.get(context.Background()); err != nil || value != 1 || requests.Load() != 2 {
+		t.Fatalf("expected the failed refetch to be retried later, got %d, %v after %d requests", value, err, requests.Load())
+	}
+
+	failing, _ := newCountingDocument(t, "", &fail)
+	if _, err := failing.get(context.Background()); err == nil {
+		t.Fatal("expected an error without a cached value")
+	}
+}
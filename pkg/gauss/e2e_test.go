@@ -0,0 +1,567 @@
+package gauss_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/temirov/GAuss/pkg/constants"
+	"github.com/temirov/GAuss/pkg/gauss"
+	"github.com/temirov/GAuss/pkg/gausstest"
+	"github.com/temirov/GAuss/pkg/session"
+	"golang.org/x/oauth2"
+)
+
+// testApp is an application protected by GAuss and logged into through a
+// gausstest provider.
+type testApp struct {
+	server   *httptest.Server
+	handlers *gauss.Handlers
+	client   *http.Client
+}
+
+func newTestApp(t *testing.T, provider *gausstest.Server, options ...gauss.Option) *testApp {
+	t.Helper()
+	mux := http.NewServeMux()
+	appServer := httptest.NewServer(mux)
+	t.Cleanup(appServer.Close)
+
+	options = append([]gauss.Option{
+		gauss.WithBaseURL(appServer.URL),
+		gauss.WithPostLoginURL("/dashboard"),
+		gauss.WithSessionStore(session.NewCookieStore([]byte("e2e-secret"))),
+		gauss.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		provider.Option(),
+	}, options...)
+	svc, err := gauss.New(provider.ClientID, provider.ClientSecret, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers, err := gauss.NewHandlers(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers.RegisterRoutes(mux)
+	mux.Handle("/dashboard", handlers.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := gauss.CurrentUser(r)
+		fmt.Fprintf(w, "hello %s", user.Email)
+	})))
+	mux.Handle("/provider", handlers.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		providerName, _ := gauss.CurrentProvider(r)
+		fmt.Fprint(w, providerName)
+	})))
+	mux.Handle("/api/me", handlers.BearerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := gauss.CurrentUser(r)
+		fmt.Fprint(w, user.Subject)
+	})))
+	mux.HandleFunc("/refresh", func(w http.ResponseWriter, r *http.Request) {
+		tokenSource, err := handlers.TokenSource(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		token, _ := tokenSource.Token()
+		fmt.Fprint(w, token.AccessToken)
+	})
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testApp{server: appServer, handlers: handlers, client: &http.Client{Jar: jar}}
+}
+
+// get fetches path and returns the final URL path and body after redirects.
+func (app *testApp) get(t *testing.T, path string) (string, string) {
+	t.Helper()
+	response, err := app.client.Get(app.server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	return response.Request.URL.RequestURI(), string(body)
+}
+
+// sessionRequest returns a request to the application carrying the client's
+// cookies.
+func (app *testApp) sessionRequest() *http.Request {
+	request := httptest.NewRequest("GET", app.server.URL+"/", nil)
+	for _, cookie := range app.client.Jar.Cookies(request.URL) {
+		request.AddCookie(cookie)
+	}
+	return request
+}
+
+// onAuthorization calls inspect with every authorization request the client
+// is redirected to on provider, before it is sent, so tests can observe or
+// tamper with it.
+func (app *testApp) onAuthorization(provider *gausstest.Server, inspect func(request *http.Request)) {
+	app.client.CheckRedirect = func(request *http.Request, via []*http.Request) error {
+		if strings.HasPrefix(request.URL.String(), provider.Endpoints().AuthURL) {
+			inspect(request)
+		}
+		return nil
+	}
+}
+
+// storedToken returns the OAuth token held in the client's session.
+func (app *testApp) storedToken(t *testing.T) *oauth2.Token {
+	t.Helper()
+	token, err := app.handlers.Token(app.sessionRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestEndToEndLogin(t *testing.T) {
+	provider := gausstest.NewServer(t,
+		gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true}),
+		gausstest.WithUser(gauss.GoogleUser{Subject: "2", Email: "bob@example.com", EmailVerified: true}),
+	)
+	for _, scopes := range [][]gauss.Scope{gauss.DefaultScopes, gauss.OpenIDScopes} {
+		app := newTestApp(t, provider, gauss.WithScopes(gauss.ScopeStrings(scopes)...))
+
+		if finalPath, _ := app.get(t, "/dashboard"); finalPath != constants.LoginPath {
+			t.Fatalf("anonymous request ended at %q", finalPath)
+		}
+		provider.SignInAs("bob@example.com")
+		finalPath, body := app.get(t, constants.GoogleAuthPath)
+		if finalPath != "/dashboard" || body != "hello bob@example.com" {
+			t.Fatalf("login ended at %q with %q", finalPath, body)
+		}
+		provider.SignInAs("")
+
+		if finalPath, _ := app.get(t, constants.LogoutPath); finalPath != constants.LoginPath {
+			t.Fatalf("logout ended at %q", finalPath)
+		}
+		if finalPath, _ := app.get(t, "/dashboard"); finalPath != constants.LoginPath {
+			t.Fatal("session survived logout")
+		}
+	}
+}
+
+func TestEndToEndDiscoveredProvider(t *testing.T) {
+	provider := gausstest.NewServer(t, gausstest.WithUser(gauss.GoogleUser{Subject: "7", Email: "carol@example.com", EmailVerified: true}))
+	discovered, err := gauss.DiscoverOIDCProvider(context.Background(), provider.URL, gauss.WithProviderName("internal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Clearing the endpoint overrides leaves the service with the discovered endpoints only.
+	app := newTestApp(t, provider, gauss.WithProvider(discovered), gauss.WithEndpoints(gauss.Endpoints{}))
+	if discovered.Endpoints().TokenInfoURL != "" || discovered.Name() != "internal" {
+		t.Fatalf("unexpected discovered provider %+v", discovered.Endpoints())
+	}
+
+	finalPath, body := app.get(t, constants.GoogleAuthPath)
+	if finalPath != "/dashboard" || body != "hello carol@example.com" {
+		t.Fatalf("login ended at %q with %q", finalPath, body)
+	}
+}
+
+func TestEndToEndMultipleProviders(t *testing.T) {
+	googleServer := gausstest.NewServer(t, gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true}))
+	internalServer := gausstest.NewServer(t,
+		gausstest.WithClient("internal-client", "internal-secret"),
+		gausstest.WithUser(gauss.GoogleUser{Subject: "7", Email: "carol@example.com", EmailVerified: true}),
+		gausstest.WithAccessTokenLifetime(5*time.Second),
+	)
+	internal, err := gauss.DiscoverOIDCProvider(context.Background(), internalServer.URL,
+		gauss.WithProviderName("internal"),
+		gauss.WithProviderDisplayName("Example SSO"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newTestApp(t, googleServer, gauss.WithAdditionalProvider(internal, "internal-client", "internal-secret"))
+
+	_, loginPage := app.get(t, constants.LoginPath)
+	for _, link := range []string{`href="/auth/google"`, `href="/auth/internal"`, "CONTINUE WITH GOOGLE", "CONTINUE WITH EXAMPLE SSO"} {
+		if !strings.Contains(loginPage, link) {
+			t.Fatalf("login page lacks %s", link)
+		}
+	}
+
+	finalPath, body := app.get(t, "/auth/internal")
+	if finalPath != "/dashboard" || body != "hello carol@example.com" {
+		t.Fatalf("login ended at %q with %q", finalPath, body)
+	}
+	if _, providerName := app.get(t, "/provider"); providerName != "internal" {
+		t.Fatalf("session recorded provider %q", providerName)
+	}
+	if _, refreshedToken := app.get(t, "/refresh"); internalServer.RefreshCount() == 0 || googleServer.RefreshCount() != 0 || refreshedToken == "" {
+		t.Fatal("expected the token to be refreshed by the provider that issued it")
+	}
+
+	app.get(t, constants.LogoutPath)
+	if finalPath, body := app.get(t, constants.GoogleAuthPath); finalPath != "/dashboard" || body != "hello alice@example.com" {
+		t.Fatalf("login ended at %q with %q", finalPath, body)
+	}
+	if _, providerName := app.get(t, "/provider"); providerName != "google" {
+		t.Fatalf("session recorded provider %q", providerName)
+	}
+}
+
+func TestEndToEndMultipleProvidersWithHostedDomain(t *testing.T) {
+	googleServer := gausstest.NewServer(t,
+		gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true, HostedDomain: "example.com"}),
+		gausstest.WithUser(gauss.GoogleUser{Subject: "2", Email: "bob@gmail.com", EmailVerified: true}),
+	)
+	internalServer := gausstest.NewServer(t,
+		gausstest.WithClient("internal-client", "internal-secret"),
+		gausstest.WithUser(gauss.GoogleUser{Subject: "7", Email: "carol@example.org", EmailVerified: true}),
+	)
+	internal, err := gauss.DiscoverOIDCProvider(context.Background(), internalServer.URL, gauss.WithProviderName("internal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newTestApp(t, googleServer,
+		gauss.WithAllowedHostedDomains("example.com"),
+		gauss.WithAdditionalProvider(internal, "internal-client", "internal-secret"),
+	)
+
+	if finalPath, body := app.get(t, "/auth/internal"); finalPath != "/dashboard" || body != "hello carol@example.org" {
+		t.Fatalf("login without an hd claim at the additional provider ended at %q with %q", finalPath, body)
+	}
+	app.get(t, constants.LogoutPath)
+	if finalPath, body := app.get(t, constants.GoogleAuthPath); finalPath != "/dashboard" || body != "hello alice@example.com" {
+		t.Fatalf("Workspace login ended at %q with %q", finalPath, body)
+	}
+	app.get(t, constants.LogoutPath)
+	googleServer.SignInAs("bob@gmail.com")
+	if finalPath, _ := app.get(t, constants.GoogleAuthPath); finalPath != constants.LoginPath+"?error=hosted_domain_not_allowed" {
+		t.Fatalf("consumer Google login ended at %q", finalPath)
+	}
+}
+
+func TestEndToEndProviderErrors(t *testing.T) {
+	provider := gausstest.NewServer(t, gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true}))
+	app := newTestApp(t, provider)
+
+	for providerError, errorCode := range map[string]string{
+		"access_denied":      "access_denied",
+		"login_required":     "login_required",
+		"<script>x</script>": "provider_error",
+	} {
+		provider.FailNextAuthorization(providerError)
+		if finalPath, _ := app.get(t, constants.GoogleAuthPath); finalPath != constants.LoginPath+"?error="+errorCode {
+			t.Fatalf("login failing with %q ended at %q", providerError, finalPath)
+		}
+	}
+	provider.FailNextTokenRequest("invalid_grant")
+	if finalPath, _ := app.get(t, constants.GoogleAuthPath); finalPath != constants.LoginPath+"?error=token_exchange_failed" {
+		t.Fatalf("failed exchange ended at %q", finalPath)
+	}
+}
+
+func TestEndToEndRefreshAndRevocation(t *testing.T) {
+	provider := gausstest.NewServer(t,
+		gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true}),
+		gausstest.WithAccessTokenLifetime(5*time.Second),
+	)
+	app := newTestApp(t, provider, gauss.WithRevokeOnLogout())
+	app.get(t, constants.GoogleAuthPath)
+
+	_, refreshedToken := app.get(t, "/refresh")
+	if provider.RefreshCount() == 0 || !strings.HasPrefix(refreshedToken, "ya29.") {
+		t.Fatalf("expected the expired token to be refreshed, got %q", refreshedToken)
+	}
+
+	app.get(t, constants.LogoutPath)
+	deadline := time.Now().Add(5 * time.Second)
+	for !provider.Revoked(refreshedToken) {
+		if time.Now().After(deadline) {
+			t.Fatal("logout did not revoke the refresh token")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEndToEndBearerTokens(t *testing.T) {
+	provider := gausstest.NewServer(t, gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true}))
+	app := newTestApp(t, provider)
+
+	for _, rawToken := range []string{provider.IssueAccessToken("alice@example.com"), provider.IssueIDToken("alice@example.com")} {
+		request, _ := http.NewRequest("GET", app.server.URL+"/api/me", nil)
+		request.Header.Set("Authorization", "Bearer "+rawToken)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK || string(body) != "1" {
+			t.Fatalf("bearer token was rejected: %d %s", response.StatusCode, body)
+		}
+	}
+}
+
+func TestEndToEndBearerTokensWithHostedDomain(t *testing.T) {
+	provider := gausstest.NewServer(t,
+		gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true, HostedDomain: "example.com"}),
+		gausstest.WithUser(gauss.GoogleUser{Subject: "2", Email: "bob@gmail.com", EmailVerified: true}),
+	)
+	app := newTestApp(t, provider, gauss.WithAllowedHostedDomains("example.com"))
+
+	testCases := []struct {
+		name       string
+		rawToken   string
+		wantStatus int
+	}{
+		{name: "workspace access token", rawToken: provider.IssueAccessToken("alice@example.com"), wantStatus: http.StatusOK},
+		{name: "workspace ID token", rawToken: provider.IssueIDToken("alice@example.com"), wantStatus: http.StatusOK},
+		{name: "consumer access token", rawToken: provider.IssueAccessToken("bob@gmail.com"), wantStatus: http.StatusForbidden},
+		{name: "consumer ID token", rawToken: provider.IssueIDToken("bob@gmail.com"), wantStatus: http.StatusForbidden},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			request, _ := http.NewRequest("GET", app.server.URL+"/api/me", nil)
+			request.Header.Set("Authorization", "Bearer "+testCase.rawToken)
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if response.StatusCode != testCase.wantStatus {
+				t.Fatalf("got status %d, want %d", response.StatusCode, testCase.wantStatus)
+			}
+		})
+	}
+}
+
+func TestEndToEndReturnTo(t *testing.T) {
+	provider := gausstest.NewServer(t, gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true}))
+	testCases := []struct {
+		name      string
+		deepLink  string
+		loginPath string
+		wantPath  string
+	}{
+		{name: "deep link", deepLink: "/dashboard?tab=summary", loginPath: constants.GoogleAuthPath, wantPath: "/dashboard?tab=summary"},
+		{name: "return_to parameter", loginPath: constants.GoogleAuthPath + "?return_to=" + url.QueryEscape("/provider"), wantPath: "/provider"},
+		{name: "open redirect", loginPath: constants.GoogleAuthPath + "?return_to=" + url.QueryEscape("//evil.example/phish"), wantPath: "/dashboard"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			app := newTestApp(t, provider)
+			if testCase.deepLink != "" {
+				if finalPath, _ := app.get(t, testCase.deepLink); finalPath != constants.LoginPath {
+					t.Fatalf("anonymous request ended at %q", finalPath)
+				}
+			}
+			if finalPath, _ := app.get(t, testCase.loginPath); finalPath != testCase.wantPath {
+				t.Fatalf("login ended at %q, want %q", finalPath, testCase.wantPath)
+			}
+		})
+	}
+}
+
+func TestEndToEndHostedDomains(t *testing.T) {
+	provider := gausstest.NewServer(t,
+		gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true, HostedDomain: "example.com"}),
+		gausstest.WithUser(gauss.GoogleUser{Subject: "2", Email: "mallory@evil.example", EmailVerified: true, HostedDomain: "evil.example"}),
+		gausstest.WithUser(gauss.GoogleUser{Subject: "3", Email: "carol@gmail.com", EmailVerified: true}),
+	)
+	testCases := []struct {
+		email    string
+		wantPath string
+	}{
+		{email: "alice@example.com", wantPath: "/dashboard"},
+		{email: "mallory@evil.example", wantPath: constants.LoginPath + "?error=hosted_domain_not_allowed"},
+		{email: "carol@gmail.com", wantPath: constants.LoginPath + "?error=hosted_domain_not_allowed"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.email, func(t *testing.T) {
+			app := newTestApp(t, provider, gauss.WithAllowedHostedDomains("example.com", "example.org"))
+			provider.SignInAs(testCase.email)
+			if finalPath, _ := app.get(t, constants.GoogleAuthPath); finalPath != testCase.wantPath {
+				t.Fatalf("login ended at %q, want %q", finalPath, testCase.wantPath)
+			}
+		})
+	}
+}
+
+func TestEndToEndOfflineIfNeeded(t *testing.T) {
+	testCases := []struct {
+		name             string
+		mode             gausstest.RefreshTokenMode
+		wantRefreshToken bool
+	}{
+		{name: "consent grants a refresh token", mode: gausstest.RefreshTokensOnConsent, wantRefreshToken: true},
+		{name: "consent without a refresh token does not loop", mode: gausstest.RefreshTokensNever},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			provider := gausstest.NewServer(t,
+				gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true}),
+				gausstest.WithRefreshTokens(testCase.mode),
+			)
+			app := newTestApp(t, provider, gauss.WithAccessType(gauss.AccessTypeOfflineIfNeeded))
+			if finalPath, _ := app.get(t, constants.GoogleAuthPath); finalPath != "/dashboard" {
+				t.Fatalf("login ended at %q", finalPath)
+			}
+			if held := app.storedToken(t).RefreshToken != ""; held != testCase.wantRefreshToken {
+				t.Fatalf("refresh token held = %v, want %v", held, testCase.wantRefreshToken)
+			}
+		})
+	}
+}
+
+func TestEndToEndOfflineIfNeededConsentDenied(t *testing.T) {
+	provider := gausstest.NewServer(t,
+		gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true}),
+		gausstest.WithRefreshTokens(gausstest.RefreshTokensOnConsent),
+	)
+	app := newTestApp(t, provider, gauss.WithAccessType(gauss.AccessTypeOfflineIfNeeded))
+	var prompts []string
+	denyConsent := true
+	app.onAuthorization(provider, func(request *http.Request) {
+		prompt := request.URL.Query().Get("prompt")
+		prompts = append(prompts, prompt)
+		if prompt == "consent" && denyConsent {
+			denyConsent = false
+			provider.FailNextAuthorization("access_denied")
+		}
+	})
+
+	if finalPath, _ := app.get(t, constants.GoogleAuthPath); finalPath != constants.LoginPath+"?error=access_denied" {
+		t.Fatalf("login with denied consent ended at %q", finalPath)
+	}
+	if finalPath, _ := app.get(t, constants.GoogleAuthPath); finalPath != "/dashboard" {
+		t.Fatalf("login ended at %q", finalPath)
+	}
+	if strings.Join(prompts, ",") != ",consent,,consent" {
+		t.Fatalf("expected every login to start without prompt=consent, got prompts %q", prompts)
+	}
+}
+
+func TestEndToEndHeldRefreshToken(t *testing.T) {
+	provider := gausstest.NewServer(t,
+		gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true}),
+		gausstest.WithRefreshTokens(gausstest.RefreshTokensNever),
+	)
+	var lookedUp *gauss.GoogleUser
+	app := newTestApp(t, provider,
+		gauss.WithAccessType(gauss.AccessTypeOfflineIfNeeded),
+		gauss.WithRefreshTokenLookup(func(ctx context.Context, user *gauss.GoogleUser) (string, error) {
+			lookedUp = user
+			return "stored-refresh-token", nil
+		}),
+	)
+	if finalPath, _ := app.get(t, constants.GoogleAuthPath); finalPath != "/dashboard" {
+		t.Fatalf("expected a one-click login, ended at %q", finalPath)
+	}
+	if lookedUp == nil || lookedUp.Subject != "1" {
+		t.Fatalf("lookup received unexpected user %+v", lookedUp)
+	}
+
+	if storedToken := app.storedToken(t); storedToken.RefreshToken != "stored-refresh-token" {
+		t.Fatalf("held refresh token not kept in session: %+v", storedToken)
+	}
+}
+
+// tamperWith replaces parameter on the authorization request.
+func tamperWith(request *http.Request, parameter string, value string) {
+	query := request.URL.Query()
+	query.Set(parameter, value)
+	request.URL.RawQuery = query.Encode()
+}
+
+func TestEndToEndPKCE(t *testing.T) {
+	provider := gausstest.NewServer(t, gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true}))
+	app := newTestApp(t, provider)
+	tamper := false
+	app.onAuthorization(provider, func(request *http.Request) {
+		query := request.URL.Query()
+		if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+			t.Errorf("expected an S256 code challenge, got %q", request.URL.RawQuery)
+		}
+		if tamper {
+			tamperWith(request, "code_challenge", oauth2.S256ChallengeFromVerifier(oauth2.GenerateVerifier()))
+		}
+	})
+
+	if finalPath, _ := app.get(t, constants.GoogleAuthPath); finalPath != "/dashboard" {
+		t.Fatalf("login ended at %q", finalPath)
+	}
+	tamper = true
+	if finalPath, _ := app.get(t, constants.GoogleAuthPath); finalPath != constants.LoginPath+"?error=token_exchange_failed" {
+		t.Fatalf("login with a mismatched code challenge ended at %q", finalPath)
+	}
+}
+
+func TestEndToEndOpenIDConnectNonce(t *testing.T) {
+	provider := gausstest.NewServer(t, gausstest.WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true}))
+	store := session.NewCookieStore([]byte("e2e-secret"))
+	app := newTestApp(t, provider, gauss.WithScopes(gauss.ScopeStrings(gauss.OpenIDScopes)...), gauss.WithSessionStore(store))
+	tamper := false
+	app.onAuthorization(provider, func(request *http.Request) {
+		if request.URL.Query().Get("nonce") == "" {
+			t.Errorf("expected a nonce, got %q", request.URL.RawQuery)
+		}
+		if tamper {
+			tamperWith(request, "nonce", "another-login")
+		}
+	})
+
+	if finalPath, _ := app.get(t, constants.GoogleAuthPath); finalPath != "/dashboard" {
+		t.Fatalf("login ended at %q", finalPath)
+	}
+	webSession, err := store.Get(app.sessionRequest(), constants.SessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if webSession.Values[constants.SessionKeyOIDCNonce] != nil {
+		t.Fatal("nonce should be cleared after login")
+	}
+
+	tamper = true
+	if finalPath, _ := app.get(t, constants.GoogleAuthPath); finalPath != constants.LoginPath+"?error=invalid_id_token" {
+		t.Fatalf("login with a replayed nonce ended at %q", finalPath)
+	}
+}
+
+func TestEndToEndServerStore(t *testing.T) {
+	provider := gausstest.NewServer(t, gausstest.WithUser(gauss.GoogleUser{
+		Subject:       "1",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Picture:       "https://example.com/" + strings.Repeat("a", 6000),
+	}))
+	store := session.NewServerStore(session.NewMemoryBackend(0), []byte("e2e-secret"))
+	app := newTestApp(t, provider, gauss.WithScopes(gauss.ScopeStrings(gauss.OpenIDScopes)...), gauss.WithSessionStore(store))
+	var preLoginRequest *http.Request
+	app.onAuthorization(provider, func(*http.Request) {
+		preLoginRequest = app.sessionRequest()
+	})
+
+	finalPath, body := app.get(t, constants.GoogleAuthPath)
+	if finalPath != "/dashboard" || body != "hello alice@example.com" {
+		t.Fatalf("login ended at %q with %q", finalPath, body)
+	}
+	for _, cookie := range app.sessionRequest().Cookies() {
+		if len(cookie.String()) > 4096 {
+			t.Fatalf("session cookie exceeds 4 KB: %d bytes", len(cookie.String()))
+		}
+	}
+	if preLoginRequest == nil || len(preLoginRequest.Cookies()) == 0 {
+		t.Fatal("expected a pre-login session cookie")
+	}
+	preLogin, _ := store.New(preLoginRequest, constants.SessionName)
+	loggedIn, _ := store.New(app.sessionRequest(), constants.SessionName)
+	if loggedIn.IsNew || loggedIn.ID == "" || loggedIn.ID == preLogin.ID {
+		t.Fatalf("expected the login to issue a new session ID, got %q", loggedIn.ID)
+	}
+	if !preLogin.IsNew {
+		t.Fatal("expected the pre-login session to be deleted")
+	}
+}
@@ -0,0 +1,84 @@
+package gauss
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// FilePolicy is an AuthorizationPolicy backed by a text file that is reloaded
+// when it changes. Each line holds one ListPolicy pattern; lines starting with
+// "!" are deny patterns and lines starting with "#" are comments:
+//
+//	# admins
+//	alice@example.com
+//	*@example.org
+//	!intern@example.org
+//
+// A file that cannot be read during a reload leaves the previous patterns in
+// effect; the failure is logged to the logger of the Service using the policy.
+type FilePolicy struct {
+	file *watchedFile
+
+	mutex sync.RWMutex
+	allow []string
+	deny  []string
+}
+
+// NewFilePolicy loads the policy file at path.
+func NewFilePolicy(path string) (*FilePolicy, error) {
+	filePolicy := &FilePolicy{}
+	file, loadError := newWatchedFile(path, filePolicy.parse)
+	if loadError != nil {
+		return nil, loadError
+	}
+	filePolicy.file = file
+	return filePolicy, nil
+}
+
+// Reload reads the policy file unconditionally.
+func (filePolicy *FilePolicy) Reload() error {
+	return filePolicy.file.reload()
+}
+
+// setReloadLogger implements reloadLogger.
+func (filePolicy *FilePolicy) setReloadLogger(logger *slog.Logger) {
+	filePolicy.file.setLogger(logger)
+}
+
+// Authorize implements AuthorizationPolicy, picking up changes to the file.
+func (filePolicy *FilePolicy) Authorize(_ context.Context, user *GoogleUser) (bool, error) {
+	filePolicy.file.reloadIfChanged()
+
+	filePolicy.mutex.RLock()
+	defer filePolicy.mutex.RUnlock()
+	return evaluateEmailPatterns(user, filePolicy.allow, filePolicy.deny), nil
+}
+
+// parse replaces the patterns with those in policyFile.
+func (filePolicy *FilePolicy) parse(policyFile *os.File) error {
+	var allow, deny []string
+	scanner := bufio.NewScanner(policyFile)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "!"):
+			deny = append(deny, strings.TrimSpace(line[1:]))
+		default:
+			allow = append(allow, line)
+		}
+	}
+	if scanError := scanner.Err(); scanError != nil {
+		return scanError
+	}
+
+	filePolicy.mutex.Lock()
+	defer filePolicy.mutex.Unlock()
+	filePolicy.allow = allow
+	filePolicy.deny = deny
+	return nil
+}
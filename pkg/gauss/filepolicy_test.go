@@ -0,0 +1,94 @@
+package gauss
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilePolicyHotReload(t *testing.T) {
+	policyPath := filepath.Join(t.TempDir(), "allowed_users.txt")
+	if err := os.WriteFile(policyPath, []byte("# admins\nalice@example.com\n*@example.org\n!intern@example.org\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	filePolicy, err := NewFilePolicy(policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePolicy.file.checkInterval = 0
+
+	authorize := func(email string) bool {
+		t.Helper()
+		allowed, err := filePolicy.Authorize(context.Background(), &GoogleUser{Email: email, EmailVerified: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return allowed
+	}
+	if !authorize("alice@example.com") || !authorize("bob@example.org") || authorize("intern@example.org") || authorize("carol@example.com") {
+		t.Fatal("initial policy evaluated incorrectly")
+	}
+
+	if err := os.WriteFile(policyPath, []byte("carol@example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(policyPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if authorize("alice@example.com") || !authorize("carol@example.com") {
+		t.Fatal("policy file changes were not picked up")
+	}
+
+	if err := os.Remove(policyPath); err != nil {
+		t.Fatal(err)
+	}
+	if !authorize("carol@example.com") {
+		t.Fatal("a missing file must keep the previous patterns")
+	}
+}
+
+func TestFilePolicyLogsReloadErrors(t *testing.T) {
+	policyPath := filepath.Join(t.TempDir(), "allowed_users.txt")
+	if err := os.WriteFile(policyPath, []byte("alice@example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	filePolicy, err := NewFilePolicy(policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePolicy.file.checkInterval = 0
+	var logOutput bytes.Buffer
+	_, err = New("id", "secret",
+		WithBaseURL("http://localhost:8080"),
+		WithAuthorizationPolicy(filePolicy),
+		WithLogger(slog.New(slog.NewTextHandler(&logOutput, nil))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A line longer than the scanner's buffer makes the file unreadable.
+	if err := os.WriteFile(policyPath, []byte(strings.Repeat("x", 128*1024)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if allowed, err := filePolicy.Authorize(context.Background(), &GoogleUser{Email: "alice@example.com", EmailVerified: true}); err != nil || !allowed {
+			t.Fatalf("expected the previous patterns to stay in effect, got %v, %v", allowed, err)
+		}
+	}
+	if count := strings.Count(logOutput.String(), "event=file_reload_failed"); count != 1 || !strings.Contains(logOutput.String(), "token too long") {
+		t.Fatalf("expected one logged reload failure, got %d in %q", count, logOutput.String())
+	}
+}
+
+func TestNewFilePolicyMissingFile(t *testing.T) {
+	if _, err := NewFilePolicy(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Fatal("expected an error for a missing policy file")
+	}
+}
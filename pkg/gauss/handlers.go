@@ -1,12 +1,16 @@
 package gauss
 
 import (
+	"crypto/subtle"
 	"embed"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"strings"
 
 	"github.com/gorilla/sessions"
 	"github.com/temirov/GAuss/pkg/constants"
@@ -17,58 +21,117 @@ import (
 //go:embed templates/*.html
 var templatesFileSystem embed.FS
 
+// templateFunctions are available to the embedded and custom templates.
+var templateFunctions = template.FuncMap{"upper": strings.ToUpper}
+
 // Handlers bundles the GAuss service, session store, and HTML templates used
 // for authentication. Instances of Handlers register HTTP endpoints that
 // implement the login and callback workflow.
 type Handlers struct {
-	service   *Service
-	store     *sessions.CookieStore
-	templates *template.Template
+	service          *Service
+	store            sessions.Store
+	templates        *template.Template
+	providerHandlers []*Handlers
+}
+
+// LoginProvider is a provider offered on the login page. Templates receive
+// them as .providers.
+type LoginProvider struct {
+	Name        string
+	DisplayName string
+	LoginURL    string
 }
 
-// NewHandlers constructs a Handlers value from a Service. It loads the login
-// templates either from the custom path specified on the Service or from the
-// embedded templates bundled with GAuss.
+// NewHandlers constructs a Handlers value from a Service. It loads the
+// embedded templates bundled with GAuss and, when the Service names a custom
+// login template, parses that file on top of them. Sessions are kept in the
+// Service's SessionStore, or in the global session.Store when none was
+// injected.
 func NewHandlers(serviceInstance *Service) (*Handlers, error) {
-	var (
-		parsedTemplates *template.Template
-		err             error
-	)
-	if serviceInstance.LoginTemplate != "" {
-		parsedTemplates, err = template.ParseFiles(serviceInstance.LoginTemplate)
-	} else {
-		parsedTemplates, err = template.ParseFS(templatesFileSystem, constants.TemplatesPath)
-	}
+	parsedTemplates, err := template.New("").Funcs(templateFunctions).ParseFS(templatesFileSystem, constants.TemplatesPath)
 	if err != nil {
 		return nil, err
 	}
+	if serviceInstance.LoginTemplate != "" {
+		if parsedTemplates, err = parsedTemplates.ParseFiles(serviceInstance.LoginTemplate); err != nil {
+			return nil, err
+		}
+	}
 
-	cookieStore := session.Store()
+	sessionStore := serviceInstance.SessionStore
+	if sessionStore == nil {
+		sessionStore = session.Store()
+	}
 
-	return &Handlers{
+	handlersInstance := &Handlers{
 		service:   serviceInstance,
-		store:     cookieStore,
+		store:     sessionStore,
 		templates: parsedTemplates,
-	}, nil
+	}
+	for _, additionalService := range serviceInstance.additionalServices {
+		handlersInstance.providerHandlers = append(handlersInstance.providerHandlers, &Handlers{
+			service:   additionalService,
+			store:     sessionStore,
+			templates: parsedTemplates,
+		})
+	}
+	return handlersInstance, nil
+}
+
+// forSession returns the Handlers of the provider recorded in webSession,
+// falling back to the primary provider for sessions that record none.
+func (handlersInstance *Handlers) forSession(webSession *sessions.Session) *Handlers {
+	providerName, _ := webSession.Values[constants.SessionKeyProvider].(string)
+	for _, providerHandlers := range handlersInstance.providerHandlers {
+		if providerHandlers.service.provider.Name() == providerName {
+			return providerHandlers
+		}
+	}
+	return handlersInstance
+}
+
+// loginProviders lists the primary and additional providers for the login
+// page.
+func (handlersInstance *Handlers) loginProviders() []LoginProvider {
+	allHandlers := append([]*Handlers{handlersInstance}, handlersInstance.providerHandlers...)
+	loginProviders := make([]LoginProvider, 0, len(allHandlers))
+	for _, providerHandlers := range allHandlers {
+		loginProviders = append(loginProviders, LoginProvider{
+			Name:        providerHandlers.service.provider.Name(),
+			DisplayName: providerHandlers.service.provider.DisplayName(),
+			LoginURL:    providerHandlers.service.routes.GoogleAuth,
+		})
+	}
+	return loginProviders
 }
 
 // RegisterRoutes installs the GAuss authentication handlers onto the provided
-// ServeMux. It returns the mux for convenience so it can be used inline.
+// ServeMux at the service's Routes, plus the login and callback routes of
+// every additional provider. It returns the mux for convenience so it can be
+// used inline.
 func (handlersInstance *Handlers) RegisterRoutes(httpMux *http.ServeMux) *http.ServeMux {
-	httpMux.HandleFunc(constants.LoginPath, handlersInstance.loginHandler)
-	httpMux.HandleFunc(constants.GoogleAuthPath, handlersInstance.Login)
-	httpMux.HandleFunc(constants.CallbackPath, handlersInstance.Callback)
-	httpMux.HandleFunc(constants.LogoutPath, handlersInstance.Logout)
+	routes := handlersInstance.service.routes
+	httpMux.HandleFunc(routes.Login, handlersInstance.loginHandler)
+	httpMux.HandleFunc(routes.GoogleAuth, handlersInstance.Login)
+	httpMux.HandleFunc(routes.Callback, handlersInstance.Callback)
+	httpMux.HandleFunc(routes.Logout, handlersInstance.Logout)
+	for _, providerHandlers := range handlersInstance.providerHandlers {
+		httpMux.HandleFunc(providerHandlers.service.routes.GoogleAuth, providerHandlers.Login)
+		httpMux.HandleFunc(providerHandlers.service.routes.Callback, providerHandlers.Callback)
+	}
 
 	return httpMux
 }
 
 // loginHandler renders the login page. If a custom template was supplied when
 // creating the Service it is used; otherwise the embedded template named by
-// constants.DefaultTemplateName is executed.
+// constants.DefaultTemplateName is executed. Templates receive the error code,
+// the routes and the LoginProviders.
 func (handlersInstance *Handlers) loginHandler(responseWriter http.ResponseWriter, request *http.Request) {
 	dataMap := map[string]interface{}{
-		"error": request.URL.Query().Get("error"),
+		"error":     request.URL.Query().Get("error"),
+		"routes":    handlersInstance.service.routes,
+		"providers": handlersInstance.loginProviders(),
 	}
 
 	var templateName string
@@ -90,121 +153,379 @@ func (handlersInstance *Handlers) loginHandler(responseWriter http.ResponseWrite
 	}
 }
 
-// Login initiates the OAuth2 flow with Google by generating a state value,
-// storing it in the session and redirecting the user to Google's authorization
-// endpoint.
+// redirectToLogin sends the client to the login route, reporting errorCode in
+// the error query parameter when it is not empty.
+func (handlersInstance *Handlers) redirectToLogin(responseWriter http.ResponseWriter, request *http.Request, errorCode string) {
+	loginURL := handlersInstance.service.routes.Login
+	if errorCode != "" {
+		loginURL += "?error=" + url.QueryEscape(errorCode)
+	}
+	http.Redirect(responseWriter, request, loginURL, http.StatusFound)
+}
+
+// loginFailure describes why Callback rejected a login. user is set once the
+// user is known, and attrs are extra log attributes.
+type loginFailure struct {
+	level     slog.Level
+	message   string
+	errorCode string
+	err       error
+	user      *GoogleUser
+	attrs     []any
+}
+
+// failLogin logs a failed login step, tagged with its error code, reports it
+// to the AuthErrorHooks and sends the client back to the login page with that
+// code.
+func (handlersInstance *Handlers) failLogin(responseWriter http.ResponseWriter, request *http.Request, logger *slog.Logger, failure loginFailure) {
+	logAttrs := append([]any{"event", "login_failed", "error_code", failure.errorCode}, failure.attrs...)
+	failureError := failure.err
+	if failureError != nil {
+		logAttrs = append(logAttrs, "error", failureError)
+	} else {
+		failureError = errors.New(failure.message)
+	}
+	logger.Log(request.Context(), failure.level, failure.message, logAttrs...)
+	handlersInstance.service.runAuthErrorHooks(request.Context(), &AuthErrorEvent{
+		Request:   request,
+		ErrorCode: failure.errorCode,
+		Err:       failureError,
+		User:      failure.user,
+	})
+	handlersInstance.redirectToLogin(responseWriter, request, failure.errorCode)
+}
+
+// Login initiates the OAuth2 flow with Google by generating a state value and a
+// PKCE code verifier, storing them in the session and redirecting the user to
+// Google's authorization endpoint with the S256 code challenge. A valid local
+// URL in the return_to query parameter is remembered for Callback.
 func (handlersInstance *Handlers) Login(responseWriter http.ResponseWriter, request *http.Request) {
+	handlersInstance.login(responseWriter, request, requestLogger(handlersInstance.service.logger, request))
+}
+
+// login implements Login, logging to logger so that a login restarted by
+// Callback keeps the callback's request ID.
+func (handlersInstance *Handlers) login(responseWriter http.ResponseWriter, request *http.Request, logger *slog.Logger) {
 	stateValue, stateError := handlersInstance.service.GenerateState()
 	if stateError != nil {
-		log.Printf("Failed to generate state: %v", stateError)
+		logger.Error("Failed to generate state", "event", "login_failed", "error", stateError)
 		http.Error(responseWriter, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	codeVerifier := handlersInstance.service.GenerateCodeVerifier()
+
 	webSession, _ := handlersInstance.store.Get(request, constants.SessionName)
-	webSession.Values["oauth_state"] = stateValue
+	// Callback sets the flag just before restarting the login for consent; a
+	// flag left by an earlier, abandoned or failed round no longer applies.
+	consentRequested := webSession.Values[constants.SessionKeyConsentRequested] == true
+	delete(webSession.Values, constants.SessionKeyConsentRequested)
+	accessType, prompt := handlersInstance.service.authorizationParameters(consentRequested)
+
+	authCodeOptions := []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("access_type", accessType),
+		oauth2.S256ChallengeOption(codeVerifier),
+	}
+	if prompt != "" {
+		authCodeOptions = append(authCodeOptions, oauth2.SetAuthURLParam("prompt", string(prompt)))
+	}
+	if hostedDomainHint := handlersInstance.service.hostedDomainHint(); hostedDomainHint != "" {
+		authCodeOptions = append(authCodeOptions, oauth2.SetAuthURLParam("hd", hostedDomainHint))
+	}
+
+	webSession.Values[constants.SessionKeyOAuthState] = stateValue
+	webSession.Values[constants.SessionKeyCodeVerifier] = codeVerifier
+	if consentRequested {
+		webSession.Values[constants.SessionKeyConsentRequested] = stateValue
+	}
+	if returnTo, valid := safeReturnTo(request.URL.Query().Get(ReturnToParameter)); valid {
+		webSession.Values[constants.SessionKeyReturnTo] = returnTo
+	}
+	if handlersInstance.service.OpenIDConnectEnabled() {
+		nonceValue, nonceError := handlersInstance.service.GenerateState()
+		if nonceError != nil {
+			logger.Error("Failed to generate nonce", "event", "login_failed", "error", nonceError)
+			http.Error(responseWriter, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		webSession.Values[constants.SessionKeyOIDCNonce] = nonceValue
+		authCodeOptions = append(authCodeOptions, oauth2.SetAuthURLParam("nonce", nonceValue))
+	}
 	if sessionSaveError := webSession.Save(request, responseWriter); sessionSaveError != nil {
-		log.Printf("Failed to save session: %v", sessionSaveError)
+		logger.Error("Failed to save session", "event", "login_failed", "error", sessionSaveError)
 		http.Error(responseWriter, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	authorizationURL := handlersInstance.service.config.AuthCodeURL(
-		stateValue,
-		oauth2.AccessTypeOffline,
-		oauth2.SetAuthURLParam("prompt", "consent"),
-	)
+	logger.Info("Redirecting to Google", "event", "login_started", "access_type", accessType, "prompt", string(prompt))
+	authorizationURL := handlersInstance.service.oauthConfig().AuthCodeURL(stateValue, authCodeOptions...)
 	http.Redirect(responseWriter, request, authorizationURL, http.StatusFound)
 }
 
 // Callback completes the OAuth2 flow. It validates the state value, exchanges
-// the code for a token and stores the retrieved user information in the
-// session before redirecting to the configured post-login URL.
+// the code together with the PKCE code verifier for a token and stores the
+// user information, taken from the verified ID token in OpenID Connect mode or
+// from the userinfo endpoint otherwise, in the session before redirecting to
+// the remembered return-to URL or, without one, the configured post-login URL.
+// LoginHooks run just before the session is saved and can veto the login;
+// AuthErrorHooks are told about every rejected login.
 func (handlersInstance *Handlers) Callback(responseWriter http.ResponseWriter, request *http.Request) {
+	logger := requestLogger(handlersInstance.service.logger, request)
 	webSession, _ := handlersInstance.store.Get(request, constants.SessionName)
-	storedStateValue, stateOk := webSession.Values["oauth_state"].(string)
+	storedStateValue, stateOk := webSession.Values[constants.SessionKeyOAuthState].(string)
 	if !stateOk {
-		log.Println("Missing state in session")
-		http.Redirect(responseWriter, request, constants.LoginPath+"?error=missing_state", http.StatusFound)
+		handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelWarn, message: "Missing state in session", errorCode: "missing_state"})
 		return
 	}
 
 	receivedStateValue := request.URL.Query().Get("state")
-	if storedStateValue != receivedStateValue {
-		log.Printf("State mismatch: stored %s vs received %s", storedStateValue, receivedStateValue)
-		http.Redirect(responseWriter, request, constants.LoginPath+"?error=invalid_state", http.StatusFound)
+	if subtle.ConstantTimeCompare([]byte(storedStateValue), []byte(receivedStateValue)) != 1 {
+		handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelWarn, message: "State mismatch", errorCode: "invalid_state", attrs: []any{"stored_state", secret(storedStateValue), "received_state", secret(receivedStateValue)}})
+		return
+	}
+
+	if providerError := request.URL.Query().Get("error"); providerError != "" {
+		handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelWarn, message: "Authorization failed at provider", errorCode: providerErrorCode(providerError)})
 		return
 	}
 
 	authorizationCode := request.URL.Query().Get("code")
 	if authorizationCode == "" {
-		log.Println("Missing authorization code")
-		http.Redirect(responseWriter, request, constants.LoginPath+"?error=missing_code", http.StatusFound)
+		handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelWarn, message: "Missing authorization code", errorCode: "missing_code"})
 		return
 	}
 
-	oauthToken, tokenExchangeError := handlersInstance.service.config.Exchange(request.Context(), authorizationCode)
-	if tokenExchangeError != nil {
-		log.Printf("Token exchange failed: %v", tokenExchangeError)
-		http.Redirect(responseWriter, request, constants.LoginPath+"?error=token_exchange_failed", http.StatusFound)
+	codeVerifier, verifierOk := webSession.Values[constants.SessionKeyCodeVerifier].(string)
+	if !verifierOk || codeVerifier == "" {
+		handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelWarn, message: "Missing code verifier in session", errorCode: "missing_verifier"})
 		return
 	}
 
-	if oauthToken.RefreshToken == "" {
-		log.Printf("Missing refresh token; re-requesting consent")
-		handlersInstance.Login(responseWriter, request)
+	expectedNonce, _ := webSession.Values[constants.SessionKeyOIDCNonce].(string)
+
+	// The state, verifier and nonce are single use and must not outlive the
+	// login attempt in the authenticated session.
+	delete(webSession.Values, constants.SessionKeyOAuthState)
+	delete(webSession.Values, constants.SessionKeyCodeVerifier)
+	delete(webSession.Values, constants.SessionKeyOIDCNonce)
+
+	oauthToken, tokenExchangeError := handlersInstance.service.oauthConfig().Exchange(
+		handlersInstance.service.providerContext(request.Context()),
+		authorizationCode,
+		oauth2.VerifierOption(codeVerifier),
+	)
+	if tokenExchangeError != nil {
+		handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelError, message: "Token exchange failed", errorCode: "token_exchange_failed", err: tokenExchangeError})
 		return
 	}
 
 	hasProfileScope := false
-	for _, scope := range handlersInstance.service.config.Scopes {
+	for _, scope := range handlersInstance.service.oauthConfig().Scopes {
 		if scope == string(ScopeProfile) || scope == string(ScopeEmail) {
 			hasProfileScope = true
 			break
 		}
 	}
 
-	if hasProfileScope {
-		// If profile scopes were requested, fetch user info as before.
-		googleUser, getUserError := handlersInstance.service.GetUser(oauthToken)
+	openIDConnectEnabled := handlersInstance.service.OpenIDConnectEnabled()
+	rawIDToken, _ := oauthToken.Extra("id_token").(string)
+
+	var googleUser *GoogleUser
+	if openIDConnectEnabled && rawIDToken != "" {
+		// The verified ID token already describes the user, so no userinfo round-trip is needed.
+		if expectedNonce == "" {
+			handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelWarn, message: "Missing nonce in session", errorCode: "missing_nonce"})
+			return
+		}
+		verifiedUser, verifyError := handlersInstance.service.VerifyIDToken(request.Context(), rawIDToken, expectedNonce)
+		if verifyError != nil {
+			handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelError, message: "Failed to verify ID token", errorCode: "invalid_id_token", err: verifyError})
+			return
+		}
+		googleUser = verifiedUser
+	} else if hasProfileScope || openIDConnectEnabled {
+		// If profile scopes were requested, or no ID token came back, fetch user info as before.
+		fetchedUser, getUserError := handlersInstance.service.GetUser(oauthToken)
 		if getUserError != nil {
-			log.Printf("Failed to get user info: %v", getUserError)
-			http.Redirect(responseWriter, request, constants.LoginPath+"?error=user_info_failed", http.StatusFound)
+			handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelError, message: "Failed to get user info", errorCode: "user_info_failed", err: getUserError})
+			return
+		}
+		googleUser = fetchedUser
+	}
+
+	if googleUser != nil {
+		logger = logger.With("sub", googleUser.Subject)
+	}
+	logger.Debug("Authorization code exchanged", "event", "token_exchanged", "has_refresh_token", oauthToken.RefreshToken != "")
+
+	if !handlersInstance.service.allowsHostedDomain(googleUser) {
+		handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelWarn, message: "Hosted domain not allowed", errorCode: "hosted_domain_not_allowed", user: googleUser})
+		return
+	}
+
+	authorized, authorizeError := handlersInstance.service.authorize(request.Context(), googleUser)
+	if authorizeError != nil {
+		handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelError, message: "Failed to evaluate authorization policy", errorCode: "authorization_failed", err: authorizeError, user: googleUser})
+		return
+	}
+	if !authorized {
+		logger.Warn("User rejected by authorization policy", "event", "login_rejected")
+		handlersInstance.service.runAuthErrorHooks(request.Context(), &AuthErrorEvent{
+			Request:   request,
+			ErrorCode: "not_authorized",
+			Err:       errors.New("user rejected by authorization policy"),
+			User:      googleUser,
+		})
+		handlersInstance.renderUnauthorized(responseWriter, googleUser)
+		return
+	}
+
+	if handlersInstance.service.roleResolver != nil {
+		if _, resolveError := handlersInstance.service.cacheRoles(request.Context(), webSession, googleUser); resolveError != nil {
+			handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelError, message: "Failed to resolve roles", errorCode: "role_resolution_failed", err: resolveError, user: googleUser})
 			return
 		}
-		webSession.Values[constants.SessionKeyUserEmail] = googleUser.Email
-		webSession.Values[constants.SessionKeyUserName] = googleUser.Name
-		webSession.Values[constants.SessionKeyUserPicture] = googleUser.Picture
+	} else {
+		delete(webSession.Values, constants.SessionKeyUserRoles)
+		delete(webSession.Values, constants.SessionKeyUserRolesResolvedAt)
+	}
+
+	if oauthToken.RefreshToken == "" {
+		switch handlersInstance.service.accessType {
+		case AccessTypeOffline:
+			logger.Warn("Google returned no refresh token")
+		case AccessTypeOfflineIfNeeded:
+			heldRefreshToken, lookupError := handlersInstance.service.heldRefreshToken(request.Context(), webSession, googleUser)
+			if lookupError != nil {
+				logger.Error("Failed to look up refresh token", "error", lookupError)
+			}
+			consentRequested := webSession.Values[constants.SessionKeyConsentRequested] == storedStateValue
+			switch {
+			case heldRefreshToken != "":
+				oauthToken.RefreshToken = heldRefreshToken
+			case !consentRequested:
+				// Ask for consent once; a second login without a refresh token proceeds without one.
+				logger.Info("No refresh token held; re-requesting consent", "event", "consent_requested")
+				webSession.Values[constants.SessionKeyConsentRequested] = true
+				handlersInstance.login(responseWriter, request, logger)
+				return
+			default:
+				logger.Warn("Google returned no refresh token after consent")
+			}
+		}
+	}
+	delete(webSession.Values, constants.SessionKeyConsentRequested)
+
+	webSession.Values[constants.SessionKeyProvider] = handlersInstance.service.provider.Name()
+	if googleUser != nil {
+		storeUserInSession(webSession, googleUser)
 	} else {
 		// If no profile scopes were requested, the user is still authenticated for API access.
 		// We set a generic, non-nil value in the session key that the AuthMiddleware checks.
 		// This confirms a valid session exists without needing the user's actual email.
-		webSession.Values[constants.SessionKeyUserEmail] = "authenticated_api_user"
+		webSession.Values[constants.SessionKeyUserEmail] = apiUserPlaceholder
 	}
 
 	// ALWAYS store the OAuth token, as this is the primary artifact for API-driven apps.
-	if tokenBytes, err := json.Marshal(oauthToken); err == nil {
-		webSession.Values[constants.SessionKeyOAuthToken] = string(tokenBytes)
-	} else {
-		log.Printf("Failed to marshal token: %v", err)
+	if storeError := storeTokenInSession(webSession, oauthToken); storeError != nil {
+		logger.Error("Failed to store token", "error", storeError)
+	}
+
+	loginEvent := &LoginEvent{Request: request, User: googleUser, Token: oauthToken, Session: webSession}
+	if hookError := handlersInstance.service.runLoginHooks(request.Context(), loginEvent); hookError != nil {
+		handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelWarn, message: "Login vetoed by hook", errorCode: loginErrorCode(hookError), err: hookError, user: googleUser})
+		return
+	}
+
+	postLoginURL := handlersInstance.service.localRedirectURL
+	if rememberedReturnTo, _ := webSession.Values[constants.SessionKeyReturnTo].(string); rememberedReturnTo != "" {
+		if returnTo, valid := safeReturnTo(rememberedReturnTo); valid {
+			postLoginURL = returnTo
+		}
+		delete(webSession.Values, constants.SessionKeyReturnTo)
+	}
+
+	if renewError := handlersInstance.renewSession(request, webSession); renewError != nil {
+		handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelError, message: "Failed to renew session", errorCode: "session_save_failed", err: renewError, user: googleUser})
+		return
 	}
 	if sessionSaveError := webSession.Save(request, responseWriter); sessionSaveError != nil {
-		log.Printf("Failed to save user session: %v", sessionSaveError)
-		http.Redirect(responseWriter, request, constants.LoginPath+"?error=session_save_failed", http.StatusFound)
+		handlersInstance.failLogin(responseWriter, request, logger, loginFailure{level: slog.LevelError, message: "Failed to save user session", errorCode: "session_save_failed", err: sessionSaveError, user: googleUser})
 		return
 	}
 
-	http.Redirect(responseWriter, request, handlersInstance.service.localRedirectURL, http.StatusFound)
+	logger.Info("Login succeeded", "event", "login_succeeded")
+	http.Redirect(responseWriter, request, postLoginURL, http.StatusFound)
+}
+
+// EstablishSession logs googleUser in with the primary provider on the
+// request's session the way Callback does after a successful login, storing
+// oauthToken when it is not nil, and writes the session cookie to
+// responseWriter. A nil googleUser creates a session for API-only scopes.
+// Hooks and the authorization policy are not run. It lets tests and trusted
+// login flows of the application, such as impersonation by an administrator,
+// create sessions that AuthMiddleware accepts; gausstest.LoginAs wraps it for
+// tests.
+func (handlersInstance *Handlers) EstablishSession(responseWriter http.ResponseWriter, request *http.Request, googleUser *GoogleUser, oauthToken *oauth2.Token) error {
+	webSession, _ := handlersInstance.store.Get(request, constants.SessionName)
+	webSession.Values[constants.SessionKeyProvider] = handlersInstance.service.provider.Name()
+	if googleUser != nil {
+		storeUserInSession(webSession, googleUser)
+	} else {
+		webSession.Values[constants.SessionKeyUserEmail] = apiUserPlaceholder
+	}
+	if oauthToken != nil {
+		if storeError := storeTokenInSession(webSession, oauthToken); storeError != nil {
+			return storeError
+		}
+	}
+	if renewError := handlersInstance.renewSession(request, webSession); renewError != nil {
+		return fmt.Errorf("failed to renew session: %w", renewError)
+	}
+	if sessionSaveError := webSession.Save(request, responseWriter); sessionSaveError != nil {
+		return fmt.Errorf("failed to save session: %w", sessionSaveError)
+	}
+	return nil
+}
+
+// sessionRenewer is implemented by session stores that keep sessions on the
+// server under an ID, such as session.ServerStore.
+type sessionRenewer interface {
+	Renew(request *http.Request, webSession *sessions.Session) error
+}
+
+// renewSession gives webSession a fresh server-side ID before it is saved as
+// an authenticated session, so an ID planted before the login cannot be used
+// to share it. Stores that keep the values in the cookie need no renewal.
+func (handlersInstance *Handlers) renewSession(request *http.Request, webSession *sessions.Session) error {
+	renewer, renews := handlersInstance.store.(sessionRenewer)
+	if !renews {
+		return nil
+	}
+	return renewer.Renew(request, webSession)
 }
 
 // Logout removes all authentication information from the session and redirects
-// the client to the login page.
+// the client to the login page. When the service's RevokeOnLogout is set, the
+// stored token is also revoked at Google in the background. LogoutHooks run
+// first for sessions of logged-in users.
 func (handlersInstance *Handlers) Logout(responseWriter http.ResponseWriter, request *http.Request) {
+	logger := requestLogger(handlersInstance.service.logger, request)
 	webSession, _ := handlersInstance.store.Get(request, constants.SessionName)
+	if googleUser, loggedIn := UserFromSession(webSession); loggedIn {
+		logger = logger.With("sub", googleUser.Subject)
+		storedToken, _ := tokenFromSession(webSession)
+		handlersInstance.service.runLogoutHooks(request.Context(), &LogoutEvent{Request: request, User: googleUser, Token: storedToken})
+	}
+	if sessionService := handlersInstance.forSession(webSession).service; sessionService.RevokeOnLogout {
+		sessionService.revokeSessionToken(request.Context(), webSession)
+	}
 	webSession.Options.MaxAge = -1
 	if webSessionSaveError := webSession.Save(request, responseWriter); webSessionSaveError != nil {
+		logger.Error("Failed to end session", "event", "logout_failed", "error", webSessionSaveError)
 		http.Error(responseWriter, webSessionSaveError.Error(), http.StatusInternalServerError)
 		return
 	}
-	http.Redirect(responseWriter, request, constants.LoginPath, http.StatusFound)
+	logger.Info("Logged out", "event", "logout")
+	handlersInstance.redirectToLogin(responseWriter, request, "")
 }
@@ -5,7 +5,13 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/temirov/GAuss/pkg/constants"
 	"github.com/temirov/GAuss/pkg/session"
@@ -26,6 +32,203 @@ func newTestHandlers(t *testing.T) *Handlers {
 	return handlers
 }
 
+// fakeProvider plays the provider in the package's tests. It serves the
+// token, userinfo, tokeninfo, revocation and discovery endpoints for one user.
+// Code exchanges return the access token "abc" without a refresh token, and
+// refresh grants return "fresh-token" after a short delay, so that concurrent
+// refreshes overlap.
+type fakeProvider struct {
+	*httptest.Server
+	refreshes         atomic.Int32
+	tokenInfoRequests atomic.Int32
+	discoveryRequests atomic.Int32
+	revocationStatus  atomic.Int32
+	revokedTokens     chan string
+
+	mutex           sync.Mutex
+	userInfo        map[string]interface{}
+	tokenAudiences  map[string]string
+	discoveryFields map[string]interface{}
+}
+
+// newFakeProvider starts a fakeProvider signing in the user described by
+// userInfo, which defaults to a user with subject "42" and email
+// "e@example.com".
+func newFakeProvider(t *testing.T, userInfo map[string]interface{}) *fakeProvider {
+	t.Helper()
+	if userInfo == nil {
+		userInfo = map[string]interface{}{"sub": "42", "email": "e@example.com"}
+	}
+	provider := &fakeProvider{
+		revokedTokens:  make(chan string, 4),
+		userInfo:       userInfo,
+		tokenAudiences: map[string]string{"abc": "id", "fresh-token": "id"},
+		discoveryFields: map[string]interface{}{
+			"issuer":                 "ISSUER",
+			"authorization_endpoint": "ISSUER/auth",
+			"token_endpoint":         "ISSUER/token",
+			"userinfo_endpoint":      "ISSUER/userinfo",
+			"jwks_uri":               "ISSUER/jwks",
+		},
+	}
+	provider.revocationStatus.Store(http.StatusOK)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", provider.token)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		provider.mutex.Lock()
+		defer provider.mutex.Unlock()
+		json.NewEncoder(w).Encode(provider.userInfo)
+	})
+	mux.HandleFunc("/tokeninfo", provider.tokenInfo)
+	mux.HandleFunc("/revoke", func(w http.ResponseWriter, r *http.Request) {
+		provider.revokedTokens <- r.FormValue("token")
+		w.WriteHeader(int(provider.revocationStatus.Load()))
+	})
+	mux.HandleFunc(discoveryPath, provider.discovery)
+	provider.Server = httptest.NewServer(mux)
+	t.Cleanup(provider.Close)
+	return provider
+}
+
+// token implements the authorization_code and refresh_token grants.
+func (provider *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.FormValue("grant_type") == "refresh_token" {
+		provider.refreshes.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		io.WriteString(w, `{"access_token":"fresh-token","token_type":"Bearer","expires_in":3600}`)
+		return
+	}
+	io.WriteString(w, `{"access_token":"abc","token_type":"bearer","expires_in":3600}`)
+}
+
+// tokenInfo describes the access tokens in tokenAudiences the way Google's
+// tokeninfo endpoint does and rejects every other token.
+func (provider *fakeProvider) tokenInfo(w http.ResponseWriter, r *http.Request) {
+	provider.tokenInfoRequests.Add(1)
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	audience, known := provider.tokenAudiences[r.FormValue("access_token")]
+	if !known {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":"invalid_token"}`)
+		return
+	}
+	subject, _ := provider.userInfo["sub"].(string)
+	email, _ := provider.userInfo["email"].(string)
+	emailVerified, _ := provider.userInfo["email_verified"].(bool)
+	json.NewEncoder(w).Encode(map[string]string{
+		"aud":            audience,
+		"azp":            audience,
+		"sub":            subject,
+		"email":          email,
+		"email_verified": strconv.FormatBool(emailVerified),
+		"exp":            strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10),
+	})
+}
+
+// acceptAccessToken makes the tokeninfo endpoint describe token as issued to
+// the client audience.
+func (provider *fakeProvider) acceptAccessToken(token string, audience string) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	provider.tokenAudiences[token] = audience
+}
+
+// discovery publishes discoveryFields with "ISSUER" in their values replaced
+// by the server's URL.
+func (provider *fakeProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	provider.discoveryRequests.Add(1)
+	provider.mutex.Lock()
+	document := make(map[string]interface{}, len(provider.discoveryFields))
+	for key, value := range provider.discoveryFields {
+		if text, isString := value.(string); isString {
+			value = strings.ReplaceAll(text, "ISSUER", provider.URL)
+		}
+		document[key] = value
+	}
+	provider.mutex.Unlock()
+	w.Header().Set("Cache-Control", "max-age=600")
+	json.NewEncoder(w).Encode(document)
+}
+
+// publishDiscovery replaces the fields of the discovery document.
+func (provider *fakeProvider) publishDiscovery(fields map[string]interface{}) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	provider.discoveryFields = fields
+}
+
+// endpoints returns the endpoints of the fake provider.
+func (provider *fakeProvider) endpoints() Endpoints {
+	return Endpoints{
+		AuthURL:       provider.URL + "/auth",
+		TokenURL:      provider.URL + "/token",
+		UserInfoURL:   provider.URL + "/userinfo",
+		TokenInfoURL:  provider.URL + "/tokeninfo",
+		RevocationURL: provider.URL + "/revoke",
+	}
+}
+
+// newServiceHandlers creates handlers with a cookie store of their own, with
+// options applied after the test defaults.
+func newServiceHandlers(t *testing.T, options ...Option) *Handlers {
+	t.Helper()
+	options = append([]Option{
+		WithBaseURL("http://localhost:8080"),
+		WithPostLoginURL("/dashboard"),
+		WithSessionStore(session.NewCookieStore([]byte("handlers-secret"))),
+	}, options...)
+	svc, err := New("id", "secret", options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHandlers(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// newProviderHandlers creates handlers using the endpoints of provider, with
+// options applied after the test defaults.
+func newProviderHandlers(t *testing.T, provider *fakeProvider, options ...Option) *Handlers {
+	t.Helper()
+	return newServiceHandlers(t, append([]Option{WithEndpoints(provider.endpoints())}, options...)...)
+}
+
+// sessionCookieWithToken saves token into a new session and returns its cookie.
+func sessionCookieWithToken(t *testing.T, h *Handlers, token *oauth2.Token) *http.Cookie {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	if err := h.EstablishSession(rr, req, &GoogleUser{Email: "e@example.com"}, token); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Result().Cookies()[0]
+}
+
+// completeAuthorization plays the provider's part: it takes a redirect to the
+// authorization endpoint and calls Callback with its state and a code.
+func completeAuthorization(t *testing.T, h *Handlers, authorizationRR *httptest.ResponseRecorder, cookies []*http.Cookie) (*httptest.ResponseRecorder, []*http.Cookie) {
+	t.Helper()
+	authURL, err := url.Parse(authorizationRR.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newCookies := authorizationRR.Result().Cookies(); len(newCookies) > 0 {
+		cookies = newCookies
+	}
+	callbackReq := httptest.NewRequest("GET", constants.CallbackPath+"?state="+url.QueryEscape(authURL.Query().Get("state"))+"&code=c1", nil)
+	for _, cookie := range cookies {
+		callbackReq.AddCookie(cookie)
+	}
+	callbackRR := httptest.NewRecorder()
+	h.Callback(callbackRR, callbackReq)
+	return callbackRR, cookies
+}
+
 func TestLoginRedirect(t *testing.T) {
 	h := newTestHandlers(t)
 	req := httptest.NewRequest("GET", constants.GoogleAuthPath, nil)
@@ -49,15 +252,22 @@ func TestCallbackSuccess(t *testing.T) {
 		io.WriteString(w, `{"access_token":"abc","token_type":"bearer","refresh_token":"rtok"}`)
 	})
 	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
-		json.NewEncoder(w).Encode(map[string]string{
-			"email":   "e@example.com",
-			"name":    "tester",
-			"picture": "pic",
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":            "1234567890",
+			"email":          "e@example.com",
+			"email_verified": true,
+			"name":           "tester",
+			"picture":        "pic",
+			"hd":             "example.com",
 		})
 	})
 	server := httptest.NewServer(mux)
 	defer server.Close()
 
+	orig := userInfoEndpoint
+	userInfoEndpoint = server.URL + "/userinfo"
+	defer func() { userInfoEndpoint = orig }()
+
 	h := newTestHandlers(t)
 
 	// override endpoints
@@ -67,15 +277,12 @@ func TestCallbackSuccess(t *testing.T) {
 		AuthStyle: oauth2.AuthStyleInParams,
 	}
 
-	orig := userInfoEndpoint
-	userInfoEndpoint = server.URL + "/userinfo"
-	defer func() { userInfoEndpoint = orig }()
-
 	// prepare request with session containing state
 	req := httptest.NewRequest("GET", constants.CallbackPath+"?state=s123&code=c1", nil)
 	initRR := httptest.NewRecorder()
 	sess, _ := session.Store().Get(req, constants.SessionName)
 	sess.Values["oauth_state"] = "s123"
+	sess.Values[constants.SessionKeyCodeVerifier] = "verifier"
 	sess.Save(req, initRR)
 	cookie := initRR.Result().Cookies()[0]
 	req.AddCookie(cookie)
@@ -100,6 +307,12 @@ func TestCallbackSuccess(t *testing.T) {
 	if sess2.Values[constants.SessionKeyUserEmail] != "e@example.com" {
 		t.Fatalf("user not stored in session")
 	}
+	if sess2.Values[constants.SessionKeyUserSubject] != "1234567890" || sess2.Values[constants.SessionKeyUserEmailVerified] != true {
+		t.Fatalf("user identity not stored in session")
+	}
+	if sess2.Values[constants.SessionKeyUserHostedDomain] != "example.com" {
+		t.Fatalf("hosted domain not stored in session")
+	}
 	if sess2.Values[constants.SessionKeyOAuthToken] == nil {
 		t.Fatalf("oauth token not stored")
 	}
@@ -141,6 +354,7 @@ func TestCallbackSuccess_APIOnlyScopes(t *testing.T) {
 	initRR := httptest.NewRecorder()
 	sess, _ := session.Store().Get(req, constants.SessionName)
 	sess.Values["oauth_state"] = "s123"
+	sess.Values[constants.SessionKeyCodeVerifier] = "verifier"
 	sess.Save(req, initRR)
 	cookie := initRR.Result().Cookies()[0]
 	req.AddCookie(cookie)
@@ -180,3 +394,98 @@ func TestCallbackSuccess_APIOnlyScopes(t *testing.T) {
 		t.Fatalf("user picture should not be stored for API-only scopes")
 	}
 }
+
+func TestCallbackMissingVerifier(t *testing.T) {
+	h := newTestHandlers(t)
+	req := httptest.NewRequest("GET", constants.CallbackPath+"?state=s123&code=c1", nil)
+	initRR := httptest.NewRecorder()
+	sess, _ := session.Store().Get(req, constants.SessionName)
+	sess.Values[constants.SessionKeyOAuthState] = "s123"
+	sess.Save(req, initRR)
+	req.AddCookie(initRR.Result().Cookies()[0])
+
+	rr := httptest.NewRecorder()
+	h.Callback(rr, req)
+	if loc := rr.Header().Get("Location"); loc != constants.LoginPath+"?error=missing_verifier" {
+		t.Fatalf("unexpected redirect %q", loc)
+	}
+}
+
+// protectedRequestWith returns a request to /dashboard carrying cookie.
+func protectedRequestWith(cookie *http.Cookie) *http.Request {
+	req := httptest.NewRequest("GET", "/dashboard", nil)
+	req.AddCookie(cookie)
+	return req
+}
+
+func TestEstablishSessionRenewsServerSessionID(t *testing.T) {
+	store := session.NewServerStore(session.NewMemoryBackend(0), []byte("secret"))
+	svc, err := NewService("id", "secret", "http://localhost:8080", "/dashboard", ScopeStrings(DefaultScopes), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.SessionStore = store
+	h, err := NewHandlers(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anonymousReq := httptest.NewRequest("GET", "/", nil)
+	anonymousRR := httptest.NewRecorder()
+	anonymous, _ := store.Get(anonymousReq, constants.SessionName)
+	anonymous.Values[constants.SessionKeyReturnTo] = "/reports"
+	anonymous.Save(anonymousReq, anonymousRR)
+	plantedCookie := anonymousRR.Result().Cookies()[0]
+
+	req := protectedRequestWith(plantedCookie)
+	rr := httptest.NewRecorder()
+	if err := h.EstablishSession(rr, req, &GoogleUser{Subject: "1", Email: "e@example.com"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	loggedIn, _ := store.New(protectedRequestWith(rr.Result().Cookies()[0]), constants.SessionName)
+	if loggedIn.ID == "" || loggedIn.ID == anonymous.ID || loggedIn.Values[constants.SessionKeyUserEmail] != "e@example.com" {
+		t.Fatalf("expected an authenticated session under a new ID, got %q", loggedIn.ID)
+	}
+	if planted, _ := store.New(protectedRequestWith(plantedCookie), constants.SessionName); !planted.IsNew {
+		t.Fatal("expected the planted session ID to be deleted")
+	}
+}
+
+func TestEstablishSession(t *testing.T) {
+	h := newTestHandlers(t)
+	protected := h.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := CurrentUser(r)
+		token, tokenErr := TokenFromRequest(r)
+		if tokenErr != nil {
+			io.WriteString(w, user.Email+" without token")
+			return
+		}
+		io.WriteString(w, user.Email+" "+token.AccessToken)
+	}))
+
+	testCases := []struct {
+		name     string
+		token    *oauth2.Token
+		wantBody string
+	}{
+		{name: "with token", token: &oauth2.Token{AccessToken: "abc"}, wantBody: "e@example.com abc"},
+		{name: "without token", token: nil, wantBody: "e@example.com without token"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			initRR := httptest.NewRecorder()
+			if err := h.EstablishSession(initRR, httptest.NewRequest("GET", "/", nil), &GoogleUser{Subject: "1", Email: "e@example.com"}, testCase.token); err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", "/dashboard", nil)
+			for _, c := range initRR.Result().Cookies() {
+				req.AddCookie(c)
+			}
+			rr := httptest.NewRecorder()
+			protected.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK || rr.Body.String() != testCase.wantBody {
+				t.Fatalf("got %d %q", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package gauss
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+	"golang.org/x/oauth2"
+)
+
+// LoginDeniedErrorCode is reported on the login page when a LoginHook vetoes
+// a login without choosing its own code.
+const LoginDeniedErrorCode = "login_denied"
+
+// LoginEvent describes a successful Google login before its session is saved.
+// User is nil for API-only scopes. Session already holds the user and the
+// token, and values a hook adds to it are saved with them.
+type LoginEvent struct {
+	Request *http.Request
+	User    *GoogleUser
+	Token   *oauth2.Token
+	Session *sessions.Session
+}
+
+// LogoutEvent describes a logged-in user logging out. Token is nil when the
+// session held none.
+type LogoutEvent struct {
+	Request *http.Request
+	User    *GoogleUser
+	Token   *oauth2.Token
+}
+
+// AuthErrorEvent describes a login that Callback rejected. ErrorCode is the
+// code shown on the login page, or "not_authorized" when the authorization
+// policy rejected the user. User is set once the user is known.
+type AuthErrorEvent struct {
+	Request   *http.Request
+	ErrorCode string
+	Err       error
+	User      *GoogleUser
+}
+
+// LoginHook is called by Callback after a user has been authenticated and
+// authorized, e.g. to provision the user in the application's database or to
+// record the login time. Returning an error vetoes the login: no session is
+// saved and the user is sent to the login page with the code of a LoginError,
+// or LoginDeniedErrorCode for other errors.
+type LoginHook interface {
+	OnLogin(ctx context.Context, event *LoginEvent) error
+}
+
+// LoginHookFunc adapts a function to LoginHook.
+type LoginHookFunc func(ctx context.Context, event *LoginEvent) error
+
+// OnLogin calls hookFunc.
+func (hookFunc LoginHookFunc) OnLogin(ctx context.Context, event *LoginEvent) error {
+	return hookFunc(ctx, event)
+}
+
+// LogoutHook is called by Logout before the session is ended.
+type LogoutHook interface {
+	OnLogout(ctx context.Context, event *LogoutEvent)
+}
+
+// LogoutHookFunc adapts a function to LogoutHook.
+type LogoutHookFunc func(ctx context.Context, event *LogoutEvent)
+
+// OnLogout calls hookFunc.
+func (hookFunc LogoutHookFunc) OnLogout(ctx context.Context, event *LogoutEvent) {
+	hookFunc(ctx, event)
+}
+
+// AuthErrorHook is called whenever Callback rejects a login, including logins
+// vetoed by a LoginHook.
+type AuthErrorHook interface {
+	OnAuthError(ctx context.Context, event *AuthErrorEvent)
+}
+
+// AuthErrorHookFunc adapts a function to AuthErrorHook.
+type AuthErrorHookFunc func(ctx context.Context, event *AuthErrorEvent)
+
+// OnAuthError calls hookFunc.
+func (hookFunc AuthErrorHookFunc) OnAuthError(ctx context.Context, event *AuthErrorEvent) {
+	hookFunc(ctx, event)
+}
+
+// LoginError lets a LoginHook choose the error code shown on the login page
+// when it vetoes a login, e.g. "account_suspended". Codes may only contain
+// lowercase letters and underscores; others are replaced by
+// LoginDeniedErrorCode.
+type LoginError struct {
+	Code string
+	Err  error
+}
+
+func (loginError *LoginError) Error() string {
+	if loginError.Err != nil {
+		return "login denied (" + loginError.Code + "): " + loginError.Err.Error()
+	}
+	return "login denied (" + loginError.Code + ")"
+}
+
+func (loginError *LoginError) Unwrap() error {
+	return loginError.Err
+}
+
+// loginErrorCode returns the login page error code for an error returned by a
+// LoginHook.
+func loginErrorCode(hookError error) string {
+	var loginError *LoginError
+	if errors.As(hookError, &loginError) {
+		return safeErrorCode(loginError.Code, LoginDeniedErrorCode)
+	}
+	return LoginDeniedErrorCode
+}
+
+// runLoginHooks calls the LoginHooks in order and stops at the first veto.
+func (serviceInstance *Service) runLoginHooks(ctx context.Context, event *LoginEvent) error {
+	for _, hook := range serviceInstance.loginHooks {
+		if hookError := hook.OnLogin(ctx, event); hookError != nil {
+			return hookError
+		}
+	}
+	return nil
+}
+
+// runLogoutHooks calls every LogoutHook.
+func (serviceInstance *Service) runLogoutHooks(ctx context.Context, event *LogoutEvent) {
+	for _, hook := range serviceInstance.logoutHooks {
+		hook.OnLogout(ctx, event)
+	}
+}
+
+// runAuthErrorHooks calls every AuthErrorHook.
+func (serviceInstance *Service) runAuthErrorHooks(ctx context.Context, event *AuthErrorEvent) {
+	for _, hook := range serviceInstance.authErrorHooks {
+		hook.OnAuthError(ctx, event)
+	}
+}
@@ -0,0 +1,105 @@
+package gauss
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/temirov/GAuss/pkg/constants"
+)
+
+func TestLoginAndLogoutHooks(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	var loggedOutUser *GoogleUser
+	h := newProviderHandlers(t, provider,
+		WithLoginHook(LoginHookFunc(func(ctx context.Context, event *LoginEvent) error {
+			if event.User == nil || event.User.Subject != "42" || event.Token.AccessToken != "abc" || event.Request == nil {
+				t.Errorf("unexpected login event %+v", event)
+			}
+			event.Session.Values["app_user_id"] = "user-7"
+			return nil
+		})),
+		WithLogoutHook(LogoutHookFunc(func(ctx context.Context, event *LogoutEvent) {
+			loggedOutUser = event.User
+		})),
+	)
+
+	cookies := loginWithRoles(t, h)
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	webSession, _ := h.store.Get(req, constants.SessionName)
+	if webSession.Values["app_user_id"] != "user-7" {
+		t.Fatalf("values added by the login hook were not saved: %v", webSession.Values)
+	}
+
+	logoutReq := httptest.NewRequest("GET", constants.LogoutPath, nil)
+	for _, cookie := range cookies {
+		logoutReq.AddCookie(cookie)
+	}
+	h.Logout(httptest.NewRecorder(), logoutReq)
+	if loggedOutUser == nil || loggedOutUser.Subject != "42" {
+		t.Fatalf("logout hook did not receive the user: %+v", loggedOutUser)
+	}
+}
+
+func TestLoginHookVeto(t *testing.T) {
+	testCases := []struct {
+		name         string
+		hookError    error
+		expectedCode string
+	}{
+		{"login error", &LoginError{Code: "account_suspended"}, "account_suspended"},
+		{"plain error", errors.New("database unavailable"), LoginDeniedErrorCode},
+		{"unsafe code", &LoginError{Code: "<script>"}, LoginDeniedErrorCode},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			provider := newFakeProvider(t, nil)
+			var reported *AuthErrorEvent
+			h := newProviderHandlers(t, provider,
+				WithLoginHook(LoginHookFunc(func(context.Context, *LoginEvent) error {
+					return testCase.hookError
+				})),
+				WithAuthErrorHook(AuthErrorHookFunc(func(ctx context.Context, event *AuthErrorEvent) {
+					reported = event
+				})),
+			)
+			loginRR := httptest.NewRecorder()
+			h.Login(loginRR, httptest.NewRequest("GET", constants.GoogleAuthPath, nil))
+			callbackRR, _ := completeAuthorization(t, h, loginRR, nil)
+
+			if location := callbackRR.Header().Get("Location"); location != constants.LoginPath+"?error="+testCase.expectedCode {
+				t.Fatalf("unexpected redirect %q", location)
+			}
+			if len(callbackRR.Result().Cookies()) != 0 {
+				t.Fatal("a vetoed login must not save a session")
+			}
+			if reported == nil || reported.ErrorCode != testCase.expectedCode || !errors.Is(reported.Err, testCase.hookError) || reported.User == nil {
+				t.Fatalf("auth error hook got %+v", reported)
+			}
+		})
+	}
+}
+
+func TestAuthErrorHookOnInvalidState(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	var reportedCode string
+	h := newProviderHandlers(t, provider, WithAuthErrorHook(AuthErrorHookFunc(func(ctx context.Context, event *AuthErrorEvent) {
+		reportedCode = event.ErrorCode
+	})))
+	loginRR := httptest.NewRecorder()
+	h.Login(loginRR, httptest.NewRequest("GET", constants.GoogleAuthPath, nil))
+	callbackReq := httptest.NewRequest("GET", constants.CallbackPath+"?state=forged&code=c1", nil)
+	for _, cookie := range loginRR.Result().Cookies() {
+		callbackReq.AddCookie(cookie)
+	}
+	callbackRR := httptest.NewRecorder()
+	h.Callback(callbackRR, callbackReq)
+	if callbackRR.Code != http.StatusFound || reportedCode != "invalid_state" {
+		t.Fatalf("expected invalid_state to be reported, got %q", reportedCode)
+	}
+}
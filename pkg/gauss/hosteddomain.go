@@ -0,0 +1,36 @@
+package gauss
+
+import "strings"
+
+// hostedDomainHint returns the hd parameter for the authorization request: the
+// domain itself when exactly one is allowed, "*" (any Workspace account) when
+// several are, and "" when logins are not restricted. The hint only narrows
+// Google's account chooser; Callback enforces the restriction.
+func (serviceInstance *Service) hostedDomainHint() string {
+	switch len(serviceInstance.allowedHostedDomains) {
+	case 0:
+		return ""
+	case 1:
+		return serviceInstance.allowedHostedDomains[0]
+	default:
+		return "*"
+	}
+}
+
+// allowsHostedDomain reports whether googleUser may log in under the hosted
+// domain restriction. The hd value must come from a verified ID token or from
+// the userinfo endpoint, never from the client.
+func (serviceInstance *Service) allowsHostedDomain(googleUser *GoogleUser) bool {
+	if len(serviceInstance.allowedHostedDomains) == 0 {
+		return true
+	}
+	if googleUser == nil || googleUser.HostedDomain == "" {
+		return false
+	}
+	for _, allowedDomain := range serviceInstance.allowedHostedDomains {
+		if strings.EqualFold(googleUser.HostedDomain, allowedDomain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package gauss
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/temirov/GAuss/pkg/constants"
+	"github.com/temirov/GAuss/pkg/session"
+)
+
+func TestHostedDomainHint(t *testing.T) {
+	testCases := []struct {
+		domains []string
+		hint    string
+	}{
+		{nil, ""},
+		{[]string{" Example.com "}, "example.com"},
+		{[]string{"example.com", "example.org"}, "*"},
+	}
+	for _, testCase := range testCases {
+		svc, err := New("id", "secret",
+			WithBaseURL("http://localhost:8080"),
+			WithSessionStore(session.NewCookieStore([]byte("hd-hint-secret"))),
+			WithAllowedHostedDomains(testCase.domains...),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := NewHandlers(svc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		h.Login(rr, httptest.NewRequest("GET", constants.GoogleAuthPath, nil))
+		authURL, err := url.Parse(rr.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := authURL.Query().Get("hd"); got != testCase.hint {
+			t.Errorf("domains %v: hd = %q, want %q", testCase.domains, got, testCase.hint)
+		}
+	}
+}
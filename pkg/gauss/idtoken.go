@@ -0,0 +1,176 @@
+package gauss
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// googleJWKSEndpoint specifies the URL that publishes Google's ID token signing
+// keys. It is a variable rather than a constant so tests can replace it with a
+// mock server endpoint.
+var googleJWKSEndpoint = "https://www.googleapis.com/oauth2/v3/certs"
+
+// googleIssuers lists the issuer values Google places in the iss claim.
+var googleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
+// idTokenClockSkew tolerates small clock differences with the issuer.
+const idTokenClockSkew = time.Minute
+
+// idTokenClaims holds the ID token claims GAuss validates. Profile claims are
+// only read from raw, through the provider's claims mapping, so their types
+// may vary between providers.
+type idTokenClaims struct {
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	Subject   string   `json:"sub"`
+	ExpiresAt int64    `json:"exp"`
+	IssuedAt  int64    `json:"iat"`
+	Nonce     string   `json:"nonce"`
+
+	// raw holds every claim for the provider's claims mapping.
+	raw map[string]interface{}
+}
+
+// audience decodes the aud claim, which may be a single string or an array.
+type audience []string
+
+func (audienceValue *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*audienceValue = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("invalid aud claim: %w", err)
+	}
+	*audienceValue = multiple
+	return nil
+}
+
+// containsAny reports whether the claim names one of clientIDs.
+func (audienceValue audience) containsAny(clientIDs []string) bool {
+	for _, value := range audienceValue {
+		if slices.Contains(clientIDs, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// idTokenVerifier validates RS256 signed ID tokens issued to a client.
+type idTokenVerifier struct {
+	clientID string
+	issuers  []string
+	keys     *keySet
+}
+
+// newIDTokenVerifier creates a verifier for tokens issued to the given client
+// ID by endpoints.Issuer and signed with the keys at endpoints.JWKSURL. Google
+// tokens may also carry the issuer without its scheme.
+func newIDTokenVerifier(clientID string, endpoints Endpoints, httpClient *http.Client) *idTokenVerifier {
+	issuers := []string{endpoints.Issuer}
+	if endpoints.Issuer == googleIssuers[0] {
+		issuers = googleIssuers
+	}
+	return &idTokenVerifier{
+		clientID: clientID,
+		issuers:  issuers,
+		keys:     newKeySet(endpoints.JWKSURL, httpClient),
+	}
+}
+
+// verify checks the signature, issuer, audience, expiry and nonce of rawIDToken
+// and returns its claims. The nonce is only compared when expectedNonce is not
+// empty.
+func (verifierInstance *idTokenVerifier) verify(ctx context.Context, rawIDToken string, expectedNonce string) (*idTokenClaims, error) {
+	return verifierInstance.verifyForAudiences(ctx, rawIDToken, expectedNonce, []string{verifierInstance.clientID})
+}
+
+// verifyForAudiences is verify for tokens that may be issued to any of
+// audiences rather than only to the verifier's client.
+func (verifierInstance *idTokenVerifier) verifyForAudiences(ctx context.Context, rawIDToken string, expectedNonce string, audiences []string) (*idTokenClaims, error) {
+	tokenParts := strings.Split(rawIDToken, ".")
+	if len(tokenParts) != 3 {
+		return nil, errors.New("malformed id token")
+	}
+
+	headerBytes, headerError := base64.RawURLEncoding.DecodeString(tokenParts[0])
+	if headerError != nil {
+		return nil, fmt.Errorf("malformed id token header: %w", headerError)
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if decodeError := json.Unmarshal(headerBytes, &header); decodeError != nil {
+		return nil, fmt.Errorf("malformed id token header: %w", decodeError)
+	}
+	if header.Algorithm != "RS256" {
+		return nil, fmt.Errorf("unsupported id token algorithm %q", header.Algorithm)
+	}
+
+	signature, signatureError := base64.RawURLEncoding.DecodeString(tokenParts[2])
+	if signatureError != nil {
+		return nil, fmt.Errorf("malformed id token signature: %w", signatureError)
+	}
+	publicKey, keyError := verifierInstance.keys.key(ctx, header.KeyID)
+	if keyError != nil {
+		return nil, keyError
+	}
+	signedContent := sha256.Sum256([]byte(tokenParts[0] + "." + tokenParts[1]))
+	if verifyError := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, signedContent[:], signature); verifyError != nil {
+		return nil, errors.New("invalid id token signature")
+	}
+
+	payloadBytes, payloadError := base64.RawURLEncoding.DecodeString(tokenParts[1])
+	if payloadError != nil {
+		return nil, fmt.Errorf("malformed id token payload: %w", payloadError)
+	}
+	var claims idTokenClaims
+	if decodeError := json.Unmarshal(payloadBytes, &claims); decodeError != nil {
+		return nil, fmt.Errorf("malformed id token payload: %w", decodeError)
+	}
+	if decodeError := json.Unmarshal(payloadBytes, &claims.raw); decodeError != nil {
+		return nil, fmt.Errorf("malformed id token payload: %w", decodeError)
+	}
+
+	issuerValid := false
+	for _, issuer := range verifierInstance.issuers {
+		if claims.Issuer == issuer {
+			issuerValid = true
+			break
+		}
+	}
+	if !issuerValid {
+		return nil, fmt.Errorf("unexpected id token issuer %q", claims.Issuer)
+	}
+	if !claims.Audience.containsAny(audiences) {
+		return nil, errors.New("id token was not issued for this client")
+	}
+	now := time.Now()
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(idTokenClockSkew)) {
+		return nil, errors.New("id token has expired")
+	}
+	if claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(idTokenClockSkew)) {
+		return nil, errors.New("id token was issued in the future")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	if expectedNonce != "" && claims.Nonce != expectedNonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+
+	return &claims, nil
+}
@@ -0,0 +1,158 @@
+package gauss
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testSigner signs ID tokens and serves the matching JWKS document.
+type testSigner struct {
+	key      *rsa.PrivateKey
+	keyID    string
+	requests atomic.Int32
+	server   *httptest.Server
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &testSigner{key: key, keyID: "test-key"}
+	signer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signer.requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": signer.keyID,
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(signer.server.Close)
+
+	orig := googleJWKSEndpoint
+	googleJWKSEndpoint = signer.server.URL
+	t.Cleanup(func() { googleJWKSEndpoint = orig })
+	return signer
+}
+
+func (signer *testSigner) sign(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": signer.keyID, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, signer.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            "https://accounts.google.com",
+		"aud":            "id",
+		"sub":            "1234567890",
+		"email":          "e@example.com",
+		"email_verified": true,
+		"name":           "tester",
+		"picture":        "pic",
+		"nonce":          "n1",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	signer := newTestSigner(t)
+	svc, err := NewService("id", "secret", "http://example.com", "/dash", ScopeStrings(OpenIDScopes), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := svc.VerifyIDToken(context.Background(), signer.sign(t, validClaims()), "n1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken error: %v", err)
+	}
+	if user.Subject != "1234567890" || user.Email != "e@example.com" || !user.EmailVerified {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+
+	// A second verification must be served from the cached key set.
+	if _, err := svc.VerifyIDToken(context.Background(), signer.sign(t, validClaims()), "n1"); err != nil {
+		t.Fatalf("VerifyIDToken error: %v", err)
+	}
+	if got := signer.requests.Load(); got != 1 {
+		t.Fatalf("expected one JWKS fetch, got %d", got)
+	}
+}
+
+func TestVerifyIDTokenStringEmailVerified(t *testing.T) {
+	signer := newTestSigner(t)
+	svc, err := NewService("id", "secret", "http://example.com", "/dash", ScopeStrings(OpenIDScopes), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := validClaims()
+	claims["email_verified"] = "true"
+	user, err := svc.VerifyIDToken(context.Background(), signer.sign(t, claims), "n1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken error: %v", err)
+	}
+	if !user.EmailVerified {
+		t.Fatalf("expected the string email_verified to be accepted: %+v", user)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	signer := newTestSigner(t)
+	svc, err := NewService("id", "secret", "http://example.com", "/dash", ScopeStrings(OpenIDScopes), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]func(claims map[string]interface{}){
+		"issuer":   func(claims map[string]interface{}) { claims["iss"] = "https://evil.example.com" },
+		"audience": func(claims map[string]interface{}) { claims["aud"] = []string{"other"} },
+		"expired":  func(claims map[string]interface{}) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"nonce":    func(claims map[string]interface{}) { claims["nonce"] = "n2" },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := validClaims()
+			mutate(claims)
+			if _, err := svc.VerifyIDToken(context.Background(), signer.sign(t, claims), "n1"); err == nil {
+				t.Fatal("expected verification error")
+			}
+		})
+	}
+
+	t.Run("signature", func(t *testing.T) {
+		parts := strings.Split(signer.sign(t, validClaims()), ".")
+		tampered, _ := json.Marshal(map[string]interface{}{"iss": "https://accounts.google.com", "aud": "id", "sub": "attacker", "nonce": "n1", "exp": time.Now().Add(time.Hour).Unix()})
+		parts[1] = base64.RawURLEncoding.EncodeToString(tampered)
+		if _, err := svc.VerifyIDToken(context.Background(), strings.Join(parts, "."), "n1"); err == nil {
+			t.Fatal("expected signature error")
+		}
+	})
+}
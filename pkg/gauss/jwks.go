@@ -0,0 +1,84 @@
+package gauss
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// keySetRefreshInterval rate limits refetches triggered by an unknown kid.
+const keySetRefreshInterval = time.Minute
+
+// keySet fetches and caches the RSA signing keys published at a JWKS URL. Keys
+// are cached as long as the JWKS response's Cache-Control header allows and
+// refetched early when a token references a key ID that is not cached yet, so
+// rotated keys are picked up. A Service's key set is shared by Callback and
+// the bearer token middleware. It is safe for concurrent use.
+type keySet struct {
+	document *cachedDocument[map[string]*rsa.PublicKey]
+}
+
+func newKeySet(keysURL string, httpClient *http.Client) *keySet {
+	return &keySet{document: newCachedDocument(keysURL, httpClient, decodeKeySet)}
+}
+
+// key returns the public key identified by keyID, refreshing the cache when
+// necessary.
+func (keySetInstance *keySet) key(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	keys, fetchError := keySetInstance.document.get(ctx)
+	if fetchError != nil {
+		return nil, fetchError
+	}
+	if publicKey, known := keys[keyID]; known {
+		return publicKey, nil
+	}
+
+	keys, fetchError = keySetInstance.document.refresh(ctx, keySetRefreshInterval)
+	if fetchError != nil {
+		return nil, fetchError
+	}
+	publicKey, known := keys[keyID]
+	if !known {
+		return nil, fmt.Errorf("unknown signing key %q", keyID)
+	}
+	return publicKey, nil
+}
+
+// decodeKeySet decodes the RSA keys of a JWKS document, skipping keys of other
+// types.
+func decodeKeySet(body io.Reader) (map[string]*rsa.PublicKey, error) {
+	var document struct {
+		Keys []struct {
+			KeyType  string `json:"kty"`
+			KeyID    string `json:"kid"`
+			Modulus  string `json:"n"`
+			Exponent string `json:"e"`
+		} `json:"keys"`
+	}
+	if decodeError := json.NewDecoder(body).Decode(&document); decodeError != nil {
+		return nil, decodeError
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(document.Keys))
+	for _, jsonWebKey := range document.Keys {
+		if jsonWebKey.KeyType != "RSA" {
+			continue
+		}
+		modulusBytes, modulusError := base64.RawURLEncoding.DecodeString(jsonWebKey.Modulus)
+		exponentBytes, exponentError := base64.RawURLEncoding.DecodeString(jsonWebKey.Exponent)
+		if modulusError != nil || exponentError != nil {
+			continue
+		}
+		keys[jsonWebKey.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulusBytes),
+			E: int(new(big.Int).SetBytes(exponentBytes).Int64()),
+		}
+	}
+	return keys, nil
+}
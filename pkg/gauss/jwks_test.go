@@ -0,0 +1,50 @@
+package gauss
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeySetRefreshesUnknownKeyID(t *testing.T) {
+	var currentKeyID atomic.Value
+	currentKeyID.Store("first")
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kty": "RSA", "kid": currentKeyID.Load().(string), "n": "AQAB", "e": "AQAB"},
+				{"kty": "EC", "kid": "elliptic", "crv": "P-256"},
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+	keys := newKeySet(server.URL, server.Client())
+
+	if _, err := keys.key(context.Background(), "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.key(context.Background(), "elliptic"); err == nil {
+		t.Fatal("expected non-RSA keys to be skipped")
+	}
+	currentKeyID.Store("rotated")
+	if _, err := keys.key(context.Background(), "rotated"); err == nil || requests.Load() != 1 {
+		t.Fatalf("expected unknown key refreshes to be rate limited, got %v after %d requests", err, requests.Load())
+	}
+
+	keys.document.mutex.Lock()
+	keys.document.fetchedAt = time.Now().Add(-keySetRefreshInterval)
+	keys.document.mutex.Unlock()
+	if _, err := keys.key(context.Background(), "rotated"); err != nil || requests.Load() != 2 {
+		t.Fatalf("expected the rotated key after a refresh, got %v after %d requests", err, requests.Load())
+	}
+	if _, err := keys.key(context.Background(), "rotated"); err != nil || requests.Load() != 2 {
+		t.Fatalf("expected the rotated key to be cached, got %v after %d requests", err, requests.Load())
+	}
+}
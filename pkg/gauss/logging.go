@@ -0,0 +1,164 @@
+package gauss
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// RequestIDHeader is the request header whose value GAuss logs as request_id.
+// Requests without a usable value get a random ID, so the events of one
+// request can still be correlated.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps the length of request IDs taken from clients.
+const maxRequestIDLength = 128
+
+// redactedValue replaces the values of sensitive log attributes.
+const redactedValue = "[REDACTED]"
+
+// sensitiveLogKeys lists the attribute keys, compared case-insensitively,
+// whose values never reach the log handler.
+var sensitiveLogKeys = map[string]bool{
+	"state":         true,
+	"code":          true,
+	"code_verifier": true,
+	"nonce":         true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"id_token":      true,
+	"authorization": true,
+	"cookie":        true,
+	"client_secret": true,
+}
+
+// secret is a sensitive string that is logged only as a short SHA-256
+// fingerprint, which tells whether two logged values are equal without
+// revealing them.
+type secret string
+
+// LogValue implements slog.LogValuer.
+func (secretValue secret) LogValue() slog.Value {
+	if secretValue == "" {
+		return slog.StringValue("")
+	}
+	digest := sha256.Sum256([]byte(secretValue))
+	return slog.StringValue("sha256:" + hex.EncodeToString(digest[:4]))
+}
+
+// redactingHandler wraps the application's slog.Handler and replaces the
+// values of sensitiveLogKeys, including inside groups, and the token endpoint
+// responses quoted by errors before they are handled.
+type redactingHandler struct {
+	next slog.Handler
+}
+
+// newRedactingLogger returns a logger writing to the handler of logger through
+// a redactingHandler.
+func newRedactingLogger(logger *slog.Logger) *slog.Logger {
+	if _, alreadyRedacting := logger.Handler().(redactingHandler); alreadyRedacting {
+		return logger
+	}
+	return slog.New(redactingHandler{next: logger.Handler()})
+}
+
+func (handler redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return handler.next.Enabled(ctx, level)
+}
+
+func (handler redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redactedRecord := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redactedRecord.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return handler.next.Handle(ctx, redactedRecord)
+}
+
+func (handler redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		redactedAttrs = append(redactedAttrs, redactAttr(attr))
+	}
+	return redactingHandler{next: handler.next.WithAttrs(redactedAttrs)}
+}
+
+func (handler redactingHandler) WithGroup(name string) slog.Handler {
+	return redactingHandler{next: handler.next.WithGroup(name)}
+}
+
+// redactAttr returns attr with its value replaced when its key is sensitive,
+// and with token endpoint responses removed from error values.
+func redactAttr(attr slog.Attr) slog.Attr {
+	if sensitiveLogKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, redactedValue)
+	}
+	value := attr.Value.Resolve()
+	if loggedError, isError := value.Any().(error); value.Kind() == slog.KindAny && isError {
+		return slog.String(attr.Key, redactError(loggedError))
+	}
+	if value.Kind() != slog.KindGroup {
+		return slog.Attr{Key: attr.Key, Value: value}
+	}
+	groupAttrs := value.Group()
+	redactedAttrs := make([]slog.Attr, 0, len(groupAttrs))
+	for _, groupAttr := range groupAttrs {
+		redactedAttrs = append(redactedAttrs, redactAttr(groupAttr))
+	}
+	return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redactedAttrs...)}
+}
+
+// redactError returns the message of loggedError with the text of a wrapped
+// oauth2.RetrieveError replaced by its status and error code. That text can
+// quote the token endpoint's response body, which may hold tokens.
+func redactError(loggedError error) string {
+	message := loggedError.Error()
+	var retrieveError *oauth2.RetrieveError
+	if !errors.As(loggedError, &retrieveError) {
+		return message
+	}
+	summary := "oauth2: token endpoint request failed"
+	if retrieveError.Response != nil {
+		summary = fmt.Sprintf("oauth2: token endpoint returned %q", retrieveError.Response.Status)
+	}
+	if retrieveError.ErrorCode != "" {
+		summary += fmt.Sprintf(" with error %q", retrieveError.ErrorCode)
+	}
+	return strings.ReplaceAll(message, retrieveError.Error(), summary)
+}
+
+// requestLogger returns logger annotated with the request's ID. When no ID
+// can be generated, the failure is logged and logger is returned unchanged.
+func requestLogger(logger *slog.Logger, request *http.Request) *slog.Logger {
+	identifier, identifierError := requestID(request)
+	if identifierError != nil {
+		logger.Error("Failed to generate request ID", "error", identifierError)
+		return logger
+	}
+	return logger.With("request_id", identifier)
+}
+
+// requestID returns the RequestIDHeader value of request when it is short and
+// printable, and a random ID otherwise.
+func requestID(request *http.Request) (string, error) {
+	headerValue := request.Header.Get(RequestIDHeader)
+	if headerValue != "" && len(headerValue) <= maxRequestIDLength && !strings.ContainsFunc(headerValue, func(character rune) bool {
+		return character < 0x21 || character > 0x7e
+	}) {
+		return headerValue, nil
+	}
+	randomBytes := make([]byte, 8)
+	if _, readError := rand.Read(randomBytes); readError != nil {
+		return "", fmt.Errorf("failed to generate request ID: %w", readError)
+	}
+	return hex.EncodeToString(randomBytes), nil
+}
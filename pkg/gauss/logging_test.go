@@ -0,0 +1,107 @@
+package gauss
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/temirov/GAuss/pkg/constants"
+	"golang.org/x/oauth2"
+)
+
+func TestRedactingLogger(t *testing.T) {
+	var output bytes.Buffer
+	logger := newRedactingLogger(slog.New(slog.NewJSONHandler(&output, nil)))
+
+	logger.With("access_token", "token-in-with").Info("event",
+		"state", "raw-state",
+		slog.Group("oauth", "Refresh_Token", "raw-refresh", "scope", "email"),
+		"stored_state", secret("raw-fingerprinted"),
+	)
+
+	logged := output.String()
+	for _, leaked := range []string{"token-in-with", "raw-state", "raw-refresh", "raw-fingerprinted"} {
+		if strings.Contains(logged, leaked) {
+			t.Fatalf("log leaked %q: %s", leaked, logged)
+		}
+	}
+	if !strings.Contains(logged, `"scope":"email"`) || !strings.Contains(logged, `"stored_state":"sha256:`) {
+		t.Fatalf("non-sensitive attributes were lost: %s", logged)
+	}
+	if newRedactingLogger(logger) != logger {
+		t.Fatal("redacting loggers must not be wrapped twice")
+	}
+}
+
+func TestRedactingLoggerSummarizesTokenEndpointErrors(t *testing.T) {
+	var output bytes.Buffer
+	logger := newRedactingLogger(slog.New(slog.NewJSONHandler(&output, nil)))
+	retrieveError := &oauth2.RetrieveError{
+		Response: &http.Response{Status: "400 Bad Request", StatusCode: http.StatusBadRequest},
+		Body:     []byte(`{"access_token":"leaked-access-token","error":"invalid_grant"}`),
+	}
+
+	logger.Error("Token exchange failed", "error", fmt.Errorf("failed to exchange token: %w", retrieveError))
+	logged := output.String()
+	if strings.Contains(logged, "leaked-access-token") {
+		t.Fatalf("log leaked the token endpoint response: %s", logged)
+	}
+	if !strings.Contains(logged, `failed to exchange token: oauth2: token endpoint returned \"400 Bad Request\"`) {
+		t.Fatalf("expected a summary of the token endpoint error: %s", logged)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "req-123")
+	if got, err := requestID(req); err != nil || got != "req-123" {
+		t.Fatalf("expected the header value, got %q, %v", got, err)
+	}
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	if got, err := requestID(req); err != nil || got == "bad id\n" || len(got) != 16 {
+		t.Fatalf("expected a generated ID for an unusable header, got %q, %v", got, err)
+	}
+}
+
+func TestCallbackLogsStructuredEvents(t *testing.T) {
+	var output bytes.Buffer
+	provider := newFakeProvider(t, nil)
+	h := newProviderHandlers(t, provider, WithLogger(slog.New(slog.NewJSONHandler(&output, nil))))
+
+	loginRR := httptest.NewRecorder()
+	h.Login(loginRR, httptest.NewRequest("GET", constants.GoogleAuthPath, nil))
+	authURL, _ := url.Parse(loginRR.Header().Get("Location"))
+	storedState := authURL.Query().Get("state")
+
+	callbackReq := httptest.NewRequest("GET", constants.CallbackPath+"?state=forged-state&code=secret-code", nil)
+	callbackReq.Header.Set(RequestIDHeader, "req-42")
+	for _, cookie := range loginRR.Result().Cookies() {
+		callbackReq.AddCookie(cookie)
+	}
+	h.Callback(httptest.NewRecorder(), callbackReq)
+
+	logged := output.String()
+	for _, leaked := range []string{storedState, "forged-state", "secret-code"} {
+		if strings.Contains(logged, leaked) {
+			t.Fatalf("log leaked %q: %s", leaked, logged)
+		}
+	}
+	for _, expected := range []string{`"event":"login_started"`, `"event":"login_failed"`, `"error_code":"invalid_state"`, `"request_id":"req-42"`} {
+		if !strings.Contains(logged, expected) {
+			t.Fatalf("log is missing %s: %s", expected, logged)
+		}
+	}
+
+	output.Reset()
+	loginRR = httptest.NewRecorder()
+	h.Login(loginRR, httptest.NewRequest("GET", constants.GoogleAuthPath, nil))
+	callbackRR, _ := completeAuthorization(t, h, loginRR, nil)
+	if callbackRR.Code != http.StatusFound || !strings.Contains(output.String(), `"event":"login_succeeded"`) || !strings.Contains(output.String(), `"sub":"42"`) {
+		t.Fatalf("expected a login_succeeded event with the user's sub: %s", output.String())
+	}
+}
@@ -1,21 +1,148 @@
 package gauss
 
 import (
+	"github.com/gorilla/sessions"
 	"github.com/temirov/GAuss/pkg/constants"
 	"github.com/temirov/GAuss/pkg/session"
+	"log/slog"
 	"net/http"
 )
 
 // AuthMiddleware ensures that a valid GAuss session exists before allowing the
-// request to proceed. Unauthenticated requests are redirected to the login
-// page.
+// request to proceed. Unauthenticated browser requests are redirected to the
+// login page; API clients receive 401 with a JSON body and HTMX requests an
+// HX-Redirect header, see WithAPIPathPrefix. Sessions are read from the
+// Handlers' own store, and the user and token are attached to the request
+// context for CurrentUser and TokenFromRequest.
+func (handlersInstance *Handlers) AuthMiddleware(nextHandler http.Handler) http.Handler {
+	return handlersInstance.sessionGuard().require(nextHandler)
+}
+
+// AuthMiddleware is the compatibility form of Handlers.AuthMiddleware that
+// reads sessions from the global store created with session.NewSession and
+// redirects to the default login path.
 func AuthMiddleware(nextHandler http.Handler) http.Handler {
 	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
-		webSession, _ := session.Store().Get(request, constants.SessionName)
-		if webSession.Values[constants.SessionKeyUserEmail] == nil {
-			http.Redirect(responseWriter, request, constants.LoginPath, http.StatusFound)
+		globalGuard := sessionGuard{store: session.Store(), loginPath: constants.LoginPath, logger: newRedactingLogger(slog.Default())}
+		globalGuard.require(nextHandler).ServeHTTP(responseWriter, request)
+	})
+}
+
+// sessionGuard holds what the middleware needs to check a request's session.
+// handlers is nil for the global middleware, which has no authorization
+// policy.
+type sessionGuard struct {
+	store           sessions.Store
+	loginPath       string
+	apiPathPrefixes []string
+	logger          *slog.Logger
+	handlers        *Handlers
+}
+
+// sessionGuard returns the guard for the Handlers' store, routes and policy.
+func (handlersInstance *Handlers) sessionGuard() sessionGuard {
+	return sessionGuard{
+		store:           handlersInstance.store,
+		loginPath:       handlersInstance.service.routes.Login,
+		apiPathPrefixes: handlersInstance.service.apiPathPrefixes,
+		logger:          handlersInstance.service.logger,
+		handlers:        handlersInstance,
+	}
+}
+
+// sessionProvider returns the provider recorded in webSession. Sessions that
+// predate the record belong to the primary provider.
+func (guard sessionGuard) sessionProvider(webSession *sessions.Session) string {
+	if providerName, _ := webSession.Values[constants.SessionKeyProvider].(string); providerName != "" {
+		return providerName
+	}
+	if guard.handlers != nil {
+		return guard.handlers.service.provider.Name()
+	}
+	return ""
+}
+
+// require wraps nextHandler so that it only runs for requests carrying a
+// logged-in session that the authorization policy still allows. Anonymous
+// requests are handled by rejectAnonymous; rejected sessions are ended with a
+// 403 page or, for API clients, a JSON error.
+func (guard sessionGuard) require(nextHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		webSession, _ := guard.store.Get(request, constants.SessionName)
+		googleUser, loggedIn := UserFromSession(webSession)
+		if !loggedIn {
+			guard.rejectAnonymous(responseWriter, request, webSession)
 			return
 		}
-		nextHandler.ServeHTTP(responseWriter, request)
+		if guard.handlers != nil {
+			authorized, authorizeError := guard.handlers.service.authorize(request.Context(), googleUser)
+			if authorizeError != nil {
+				requestLogger(guard.logger, request).Error("Failed to evaluate authorization policy", "error", authorizeError)
+				http.Error(responseWriter, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !authorized {
+				requestLogger(guard.logger, request).Warn("Session rejected by authorization policy", "event", "session_rejected", "sub", googleUser.Subject)
+				guard.handlers.endSession(responseWriter, request, webSession)
+				if isAPIRequest(request, guard.apiPathPrefixes) {
+					writeJSONError(responseWriter, http.StatusForbidden, apiErrorResponse{
+						Error:   "forbidden",
+						Message: "You are not allowed to use this application.",
+					})
+					return
+				}
+				guard.handlers.renderUnauthorized(responseWriter, googleUser)
+				return
+			}
+		}
+		var userRoles []string
+		if guard.handlers != nil && guard.handlers.service.roleResolver != nil {
+			var rolesError error
+			if userRoles, rolesError = guard.handlers.sessionRoles(responseWriter, request, webSession, googleUser); rolesError != nil {
+				requestLogger(guard.logger, request).Error("Failed to resolve roles", "sub", googleUser.Subject, "error", rolesError)
+				http.Error(responseWriter, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		oauthToken, tokenError := tokenFromSession(webSession)
+		identity := &requestIdentity{user: googleUser, provider: guard.sessionProvider(webSession), roles: userRoles, token: oauthToken, tokenError: tokenError}
+		nextHandler.ServeHTTP(responseWriter, request.WithContext(contextWithIdentity(request.Context(), identity)))
 	})
 }
+
+// rejectAnonymous answers a request without a logged-in session. HTMX requests
+// get 401 with an HX-Redirect to the login page, so the whole page navigates
+// instead of the login page being swapped into it. Other API clients get 401
+// with a JSON body and a WWW-Authenticate challenge. Browser navigations are
+// redirected to the login page. For browsers and HTMX the page being viewed is
+// remembered first, so Callback returns there after the login.
+func (guard sessionGuard) rejectAnonymous(responseWriter http.ResponseWriter, request *http.Request, webSession *sessions.Session) {
+	switch {
+	case isHTMXRequest(request):
+		guard.rememberReturnTo(responseWriter, request, webSession, htmxReturnTo)
+		responseWriter.Header().Set("HX-Redirect", guard.loginPath)
+		responseWriter.WriteHeader(http.StatusUnauthorized)
+	case isAPIRequest(request, guard.apiPathPrefixes):
+		responseWriter.Header().Set("WWW-Authenticate", AuthenticateChallenge)
+		writeJSONError(responseWriter, http.StatusUnauthorized, apiErrorResponse{
+			Error:    "unauthenticated",
+			Message:  "Authentication required.",
+			LoginURL: guard.loginPath,
+		})
+	default:
+		guard.rememberReturnTo(responseWriter, request, webSession, returnToFromRequest)
+		http.Redirect(responseWriter, request, guard.loginPath, http.StatusFound)
+	}
+}
+
+// rememberReturnTo stores the return-to URL chosen by returnTo in the session.
+func (guard sessionGuard) rememberReturnTo(responseWriter http.ResponseWriter, request *http.Request, webSession *sessions.Session, returnTo func(*http.Request) (string, bool)) {
+	returnToURL, remember := returnTo(request)
+	if !remember {
+		return
+	}
+	webSession.Values[constants.SessionKeyReturnTo] = returnToURL
+	if sessionSaveError := webSession.Save(request, responseWriter); sessionSaveError != nil {
+		requestLogger(guard.logger, request).Error("Failed to remember return-to URL", "error", sessionSaveError)
+	}
+}
@@ -1,6 +1,7 @@
 package gauss
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -40,3 +41,116 @@ func TestAuthMiddlewarePasses(t *testing.T) {
 		t.Fatalf("expected ok, got %d", rr.Code)
 	}
 }
+
+func TestHandlersAuthMiddlewareUsesOwnStore(t *testing.T) {
+	t.Parallel()
+	first := newServiceHandlers(t, WithSessionStore(session.NewCookieStore([]byte("first-secret"))))
+	second := newServiceHandlers(t, WithSessionStore(session.NewCookieStore([]byte("second-secret"))))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rrInit := httptest.NewRecorder()
+	s, _ := first.store.Get(req, constants.SessionName)
+	s.Values[constants.SessionKeyUserEmail] = "e@example.com"
+	s.Save(req, rrInit)
+	cookie := rrInit.Result().Cookies()[0]
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	firstReq := httptest.NewRequest("GET", "/", nil)
+	firstReq.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	first.AuthMiddleware(ok).ServeHTTP(rr, firstReq)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected ok from issuing instance, got %d", rr.Code)
+	}
+
+	secondReq := httptest.NewRequest("GET", "/", nil)
+	secondReq.AddCookie(cookie)
+	rr = httptest.NewRecorder()
+	second.AuthMiddleware(ok).ServeHTTP(rr, secondReq)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected redirect from other instance, got %d", rr.Code)
+	}
+}
+
+func TestAuthMiddlewareAnswersAPIClients(t *testing.T) {
+	svc, err := New("id", "secret",
+		WithBaseURL("http://example.com"),
+		WithSessionStore(session.NewCookieStore([]byte("api-secret"))),
+		WithAPIPathPrefix("/api/"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHandlers(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := h.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("anonymous request reached the handler")
+	}))
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+	}{
+		{"accept json", "/reports", map[string]string{"Accept": "application/json"}},
+		{"x-requested-with", "/reports", map[string]string{"X-Requested-With": "XMLHttpRequest"}},
+		{"api path prefix", "/api/items", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			protected.ServeHTTP(rr, req)
+			if rr.Code != http.StatusUnauthorized {
+				t.Fatalf("expected 401, got %d", rr.Code)
+			}
+			if rr.Header().Get("WWW-Authenticate") != AuthenticateChallenge {
+				t.Fatalf("missing WWW-Authenticate header: %v", rr.Header())
+			}
+			var body apiErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Error != "unauthenticated" || body.LoginURL != constants.LoginPath {
+				t.Fatalf("unexpected body %q (%v)", rr.Body.String(), err)
+			}
+			if len(rr.Result().Cookies()) != 0 {
+				t.Fatal("API requests must not be remembered as return-to URLs")
+			}
+		})
+	}
+
+	t.Run("htmx", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/fragments/list", nil)
+		req.Header.Set("HX-Request", "true")
+		req.Header.Set("HX-Current-URL", "http://example.com/reports?page=2")
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized || rr.Header().Get("HX-Redirect") != constants.LoginPath {
+			t.Fatalf("expected 401 with HX-Redirect, got %d %v", rr.Code, rr.Header())
+		}
+		remembered := httptest.NewRequest("GET", "/", nil)
+		for _, cookie := range rr.Result().Cookies() {
+			remembered.AddCookie(cookie)
+		}
+		webSession, _ := h.store.Get(remembered, constants.SessionName)
+		if returnTo := webSession.Values[constants.SessionKeyReturnTo]; returnTo != "/reports?page=2" {
+			t.Fatalf("expected the current page to be remembered, got %v", returnTo)
+		}
+	})
+
+	t.Run("browser", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/apiary", nil)
+		req.Header.Set("Accept", "text/html,application/json;q=0.9")
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		if rr.Code != http.StatusFound || rr.Header().Get("Location") != constants.LoginPath {
+			t.Fatalf("expected redirect to login, got %d", rr.Code)
+		}
+	})
+}
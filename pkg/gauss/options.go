@@ -0,0 +1,381 @@
+package gauss
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/temirov/GAuss/pkg/constants"
+	"golang.org/x/oauth2"
+)
+
+// Prompt is the value of the prompt parameter sent to Google's authorization
+// endpoint.
+type Prompt string
+
+const (
+	// PromptConsent shows the consent screen on every login. It is the default
+	// because Google only returns a refresh token after consent.
+	PromptConsent Prompt = "consent"
+	// PromptSelectAccount shows the account chooser without forcing consent.
+	PromptSelectAccount Prompt = "select_account"
+	// PromptNone never shows any Google UI and fails if interaction is needed.
+	PromptNone Prompt = "none"
+)
+
+// AccessType is the value of the access_type parameter sent to Google's
+// authorization endpoint.
+type AccessType string
+
+const (
+	// AccessTypeOffline requests a refresh token. It is the default.
+	AccessTypeOffline AccessType = "offline"
+	// AccessTypeOnline only requests an access token.
+	AccessTypeOnline AccessType = "online"
+	// AccessTypeOfflineIfNeeded requests offline access without forcing the
+	// consent screen. Only when Google returns no refresh token and none is
+	// held for the user does Callback restart the login once with
+	// prompt=consent. It is a GAuss mode, sent to Google as "offline".
+	AccessTypeOfflineIfNeeded AccessType = "offline_if_needed"
+)
+
+// RefreshTokenLookup returns a refresh token the application already holds for
+// user, or "" when it holds none. user is nil for API-only scopes.
+type RefreshTokenLookup func(ctx context.Context, user *GoogleUser) (string, error)
+
+// Routes lists the paths at which Handlers serve the login flow. Empty fields
+// fall back to the constants.*Path defaults.
+type Routes struct {
+	Login      string
+	GoogleAuth string
+	Callback   string
+	Logout     string
+}
+
+// withDefaults fills empty route paths with the package defaults.
+func (routes Routes) withDefaults() Routes {
+	if routes.Login == "" {
+		routes.Login = constants.LoginPath
+	}
+	if routes.GoogleAuth == "" {
+		routes.GoogleAuth = constants.GoogleAuthPath
+	}
+	if routes.Callback == "" {
+		routes.Callback = constants.CallbackPath
+	}
+	if routes.Logout == "" {
+		routes.Logout = constants.LogoutPath
+	}
+	return routes
+}
+
+// withPrefix mounts every route below prefix, e.g. "/admin".
+func (routes Routes) withPrefix(prefix string) Routes {
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix == "" {
+		return routes
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	routes.Login = prefix + routes.Login
+	routes.GoogleAuth = prefix + routes.GoogleAuth
+	routes.Callback = prefix + routes.Callback
+	routes.Logout = prefix + routes.Logout
+	return routes
+}
+
+// Endpoints overrides the provider URLs the Service talks to. Empty fields keep
+// the endpoints of the Service's Provider, Google's production endpoints by
+// default. Issuer replaces the accepted iss claim of ID
+// tokens.
+type Endpoints struct {
+	AuthURL       string
+	TokenURL      string
+	UserInfoURL   string
+	JWKSURL       string
+	RevocationURL string
+	TokenInfoURL  string
+	Issuer        string
+	// AuthStyle sets how the client authenticates at TokenURL. Zero keeps
+	// the provider's style.
+	AuthStyle oauth2.AuthStyle
+}
+
+// serviceConfig collects the settings applied by Options before New builds the
+// Service.
+type serviceConfig struct {
+	baseURL             string
+	postLoginURL        string
+	scopes              []string
+	loginTemplate       string
+	sessionStore        sessions.Store
+	httpClient          *http.Client
+	logger              *slog.Logger
+	routes              Routes
+	pathPrefix          string
+	provider            Provider
+	additionalProviders []additionalProvider
+	endpoints           Endpoints
+	prompt              Prompt
+	promptConfigured    bool
+	accessType          AccessType
+	refreshTokenLookup  RefreshTokenLookup
+	hostedDomains       []string
+	authorizationPolicy AuthorizationPolicy
+	roleResolver        RoleResolver
+	roleCacheDuration   time.Duration
+	apiPathPrefixes     []string
+	bearerAudiences     []string
+	loginHooks          []LoginHook
+	logoutHooks         []LogoutHook
+	authErrorHooks      []AuthErrorHook
+	revokeOnLogout      bool
+}
+
+// Option configures a Service created with New.
+type Option func(*serviceConfig)
+
+// WithBaseURL sets the publicly reachable URL of the application, e.g.
+// "https://example.com". The OAuth callback URL is resolved against it. It is
+// required.
+func WithBaseURL(baseURL string) Option {
+	return func(config *serviceConfig) {
+		config.baseURL = baseURL
+	}
+}
+
+// WithPostLoginURL sets where users are sent after logging in when no return-to
+// URL was remembered. It defaults to "/".
+func WithPostLoginURL(postLoginURL string) Option {
+	return func(config *serviceConfig) {
+		config.postLoginURL = postLoginURL
+	}
+}
+
+// WithScopes sets the OAuth scopes to request. Without it DefaultScopes are
+// requested.
+func WithScopes(scopes ...string) Option {
+	return func(config *serviceConfig) {
+		config.scopes = append([]string(nil), scopes...)
+	}
+}
+
+// WithLoginTemplate replaces the embedded login page with the template file at
+// templatePath.
+func WithLoginTemplate(templatePath string) Option {
+	return func(config *serviceConfig) {
+		config.loginTemplate = templatePath
+	}
+}
+
+// WithSessionStore sets the store Handlers keep sessions in. Without it the
+// global store created with session.NewSession is used.
+func WithSessionStore(store sessions.Store) Option {
+	return func(config *serviceConfig) {
+		config.sessionStore = store
+	}
+}
+
+// WithHTTPClient sets the client used for every call to the provider: token
+// exchange and refresh, userinfo, signing keys and revocation.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(config *serviceConfig) {
+		config.httpClient = httpClient
+	}
+}
+
+// WithLogger sets the logger Handlers and middleware report login events and
+// failures to. It defaults to slog.Default(). Sensitive attributes such as
+// states, codes and tokens are redacted before they reach its handler.
+func WithLogger(logger *slog.Logger) Option {
+	return func(config *serviceConfig) {
+		config.logger = logger
+	}
+}
+
+// WithRoutes overrides the paths of the login flow.
+func WithRoutes(routes Routes) Option {
+	return func(config *serviceConfig) {
+		config.routes = routes
+	}
+}
+
+// WithPathPrefix mounts the login flow below prefix, so "/admin" serves the
+// login page at "/admin/login" and expects Google to call back at
+// "/admin/auth/google/callback". The prefix also applies to paths set with
+// WithRoutes.
+func WithPathPrefix(prefix string) Option {
+	return func(config *serviceConfig) {
+		config.pathPrefix = prefix
+	}
+}
+
+// WithProvider logs users in with provider instead of Google, e.g. with a
+// provider returned by DiscoverOIDCProvider. The client ID and secret passed
+// to New must then belong to that provider.
+func WithProvider(provider Provider) Option {
+	return func(config *serviceConfig) {
+		config.provider = provider
+	}
+}
+
+// additionalProvider is a provider added with WithAdditionalProvider.
+type additionalProvider struct {
+	provider     Provider
+	clientID     string
+	clientSecret string
+	scopes       []string
+}
+
+// WithAdditionalProvider offers provider on the login page next to the
+// primary one, using the given OAuth client. Its login starts at
+// "/auth/<name>" and returns to "/auth/<name>/callback", below WithPathPrefix,
+// where name is the provider's Name; register that callback URL with the
+// provider. scopes default to the provider's DefaultScopes. Every other
+// setting, such as policies, hooks and the session store, is shared with the
+// primary provider, except that WithAllowedHostedDomains only restricts Google. New fails when these routes equal one of the primary
+// provider's, e.g. an additional Google provider next to a primary provider
+// still using the default "/auth/google" routes; move the primary's routes
+// with WithRoutes then.
+func WithAdditionalProvider(provider Provider, clientID string, clientSecret string, scopes ...string) Option {
+	return func(config *serviceConfig) {
+		config.additionalProviders = append(config.additionalProviders, additionalProvider{
+			provider:     provider,
+			clientID:     clientID,
+			clientSecret: clientSecret,
+			scopes:       append([]string(nil), scopes...),
+		})
+	}
+}
+
+// WithEndpoints overrides the primary provider's endpoints, for example to point the
+// Service at a local test server.
+func WithEndpoints(endpoints Endpoints) Option {
+	return func(config *serviceConfig) {
+		config.endpoints = endpoints
+	}
+}
+
+// WithPrompt sets the prompt parameter of the authorization request. An empty
+// prompt omits the parameter. Without WithPrompt, AccessTypeOffline uses
+// PromptConsent and the other access types send no prompt.
+func WithPrompt(prompt Prompt) Option {
+	return func(config *serviceConfig) {
+		config.prompt = prompt
+		config.promptConfigured = true
+	}
+}
+
+// WithAccessType sets the access_type parameter of the authorization request.
+func WithAccessType(accessType AccessType) Option {
+	return func(config *serviceConfig) {
+		config.accessType = accessType
+	}
+}
+
+// WithRefreshTokenLookup lets AccessTypeOfflineIfNeeded find refresh tokens the
+// application stored from earlier logins, so returning users are not sent to
+// the consent screen. The refresh token found is kept in the new session.
+func WithRefreshTokenLookup(lookup RefreshTokenLookup) Option {
+	return func(config *serviceConfig) {
+		config.refreshTokenLookup = lookup
+	}
+}
+
+// WithRevokeOnLogout makes Logout revoke the session's token at the provider.
+func WithRevokeOnLogout() Option {
+	return func(config *serviceConfig) {
+		config.revokeOnLogout = true
+	}
+}
+
+// WithAllowedHostedDomains restricts logins to Google Workspace accounts of the
+// given domains, e.g. "example.com". Google is sent the matching hd hint, and
+// Callback rejects users whose verified hd claim is not listed with the error
+// code "hosted_domain_not_allowed". The restriction needs the user's profile,
+// so it cannot be combined with API-only scopes. It applies to Google logins
+// only: providers added with WithAdditionalProvider other than Google issue no
+// hd claim and are not restricted.
+func WithAllowedHostedDomains(domains ...string) Option {
+	return func(config *serviceConfig) {
+		config.hostedDomains = config.hostedDomains[:0]
+		for _, domain := range domains {
+			if trimmedDomain := strings.ToLower(strings.TrimSpace(domain)); trimmedDomain != "" {
+				config.hostedDomains = append(config.hostedDomains, trimmedDomain)
+			}
+		}
+	}
+}
+
+// WithAuthorizationPolicy admits only the users policy allows. Rejected users
+// get a 403 "not authorized" page instead of a session, and sessions of users
+// the policy no longer allows are ended by AuthMiddleware.
+func WithAuthorizationPolicy(policy AuthorizationPolicy) Option {
+	return func(config *serviceConfig) {
+		config.authorizationPolicy = policy
+	}
+}
+
+// WithRoleResolver enables role-based access control with RequireRole and
+// related middleware. Roles are resolved at login and cached in the session.
+func WithRoleResolver(resolver RoleResolver) Option {
+	return func(config *serviceConfig) {
+		config.roleResolver = resolver
+	}
+}
+
+// WithRoleCacheTTL sets how long roles cached in the session are used before
+// the RoleResolver is asked again. It defaults to ten minutes.
+func WithRoleCacheTTL(duration time.Duration) Option {
+	return func(config *serviceConfig) {
+		config.roleCacheDuration = duration
+	}
+}
+
+// WithAPIPathPrefix marks every path below the given prefixes, e.g. "/api", as
+// an API endpoint. AuthMiddleware answers unauthenticated requests to them with
+// 401 and a JSON body instead of redirecting to the login page. Requests that
+// accept only JSON or carry X-Requested-With are treated the same way
+// regardless of their path.
+func WithAPIPathPrefix(prefixes ...string) Option {
+	return func(config *serviceConfig) {
+		config.apiPathPrefixes = append(config.apiPathPrefixes, prefixes...)
+	}
+}
+
+// WithBearerAudiences lets BearerMiddleware accept tokens issued to other
+// OAuth clients of the same project, such as the Android, iOS or CLI clients,
+// in addition to the Service's own client ID.
+func WithBearerAudiences(clientIDs ...string) Option {
+	return func(config *serviceConfig) {
+		config.bearerAudiences = append(config.bearerAudiences, clientIDs...)
+	}
+}
+
+// WithLoginHook adds a hook Callback runs after authenticating and authorizing
+// a user, before the session is saved. Hooks run in the order they were added
+// and any of them can veto the login.
+func WithLoginHook(hook LoginHook) Option {
+	return func(config *serviceConfig) {
+		config.loginHooks = append(config.loginHooks, hook)
+	}
+}
+
+// WithLogoutHook adds a hook Logout runs before ending a logged-in session.
+func WithLogoutHook(hook LogoutHook) Option {
+	return func(config *serviceConfig) {
+		config.logoutHooks = append(config.logoutHooks, hook)
+	}
+}
+
+// WithAuthErrorHook adds a hook that is told about every login Callback
+// rejects.
+func WithAuthErrorHook(hook AuthErrorHook) Option {
+	return func(config *serviceConfig) {
+		config.authErrorHooks = append(config.authErrorHooks, hook)
+	}
+}
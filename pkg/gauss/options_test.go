@@ -0,0 +1,232 @@
+package gauss
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/temirov/GAuss/pkg/constants"
+	"github.com/temirov/GAuss/pkg/session"
+)
+
+// countingTransport counts the requests sent through an *http.Client.
+type countingTransport struct {
+	count atomic.Int32
+}
+
+func (transport *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	transport.count.Add(1)
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func TestNewRequiresCredentialsAndBaseURL(t *testing.T) {
+	if _, err := New("", "secret", WithBaseURL("http://localhost:8080")); err == nil {
+		t.Fatal("expected an error without a client ID")
+	}
+	if _, err := New("id", "secret"); err == nil {
+		t.Fatal("expected an error without a base URL")
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	svc, err := New("id", "secret", WithBaseURL("http://localhost:8080"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.config.RedirectURL != "http://localhost:8080"+constants.CallbackPath {
+		t.Fatalf("unexpected redirect URL %s", svc.config.RedirectURL)
+	}
+	if svc.localRedirectURL != "/" || svc.prompt != PromptConsent || svc.accessType != AccessTypeOffline {
+		t.Fatalf("unexpected defaults: %+v", svc)
+	}
+	if svc.Routes().Login != constants.LoginPath || svc.RevocationURL != GoogleRevocationURL {
+		t.Fatalf("unexpected default routes or endpoints: %+v", svc.Routes())
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	transport := &countingTransport{}
+	store := session.NewCookieStore([]byte("options-secret"))
+	svc, err := New("id", "secret",
+		WithBaseURL("https://app.example.com"),
+		WithPostLoginURL("/home"),
+		WithScopes(string(ScopeProfile), string(ScopeEmail)),
+		WithSessionStore(store),
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithRoutes(Routes{Login: "/admin/login", GoogleAuth: "/admin/auth", Callback: "/admin/callback", Logout: "/admin/logout"}),
+		WithEndpoints(provider.endpoints()),
+		WithPrompt(PromptSelectAccount),
+		WithAccessType(AccessTypeOnline),
+		WithRevokeOnLogout(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.config.RedirectURL != "https://app.example.com/admin/callback" {
+		t.Fatalf("unexpected redirect URL %s", svc.config.RedirectURL)
+	}
+	if !svc.RevokeOnLogout {
+		t.Fatal("WithRevokeOnLogout was not applied")
+	}
+	h, err := NewHandlers(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.store != store {
+		t.Fatal("WithSessionStore was not applied")
+	}
+	appMux := h.RegisterRoutes(http.NewServeMux())
+
+	loginRR := httptest.NewRecorder()
+	appMux.ServeHTTP(loginRR, httptest.NewRequest("GET", "/admin/auth", nil))
+	authURL, err := url.Parse(loginRR.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL.String(), provider.URL+"/auth") {
+		t.Fatalf("unexpected authorization URL %s", authURL)
+	}
+	if authURL.Query().Get("prompt") != "select_account" || authURL.Query().Get("access_type") != "online" {
+		t.Fatalf("unexpected prompt or access type in %s", authURL)
+	}
+
+	callbackReq := httptest.NewRequest("GET", "/admin/callback?state="+url.QueryEscape(authURL.Query().Get("state"))+"&code=c1", nil)
+	for _, cookie := range loginRR.Result().Cookies() {
+		callbackReq.AddCookie(cookie)
+	}
+	callbackRR := httptest.NewRecorder()
+	appMux.ServeHTTP(callbackRR, callbackReq)
+	if location := callbackRR.Header().Get("Location"); location != "/home" {
+		t.Fatalf("expected redirect to /home, got %q", location)
+	}
+	if transport.count.Load() != 2 {
+		t.Fatalf("expected token and userinfo calls through the custom client, got %d", transport.count.Load())
+	}
+
+	anonymousRR := httptest.NewRecorder()
+	h.AuthMiddleware(http.NotFoundHandler()).ServeHTTP(anonymousRR, httptest.NewRequest("GET", "/admin/reports", nil))
+	if location := anonymousRR.Header().Get("Location"); location != "/admin/login" {
+		t.Fatalf("expected redirect to the configured login route, got %q", location)
+	}
+}
+
+func TestWithPathPrefix(t *testing.T) {
+	svc, err := New("id", "secret",
+		WithBaseURL("https://app.example.com"),
+		WithPathPrefix("/admin/"),
+		WithSessionStore(session.NewCookieStore([]byte("prefix-secret"))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedRoutes := Routes{Login: "/admin/login", GoogleAuth: "/admin/auth/google", Callback: "/admin/auth/google/callback", Logout: "/admin/logout"}
+	if svc.Routes() != expectedRoutes {
+		t.Fatalf("unexpected routes: %+v", svc.Routes())
+	}
+	if svc.config.RedirectURL != "https://app.example.com/admin/auth/google/callback" {
+		t.Fatalf("unexpected redirect URL %s", svc.config.RedirectURL)
+	}
+	h, err := NewHandlers(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appMux := h.RegisterRoutes(http.NewServeMux())
+
+	loginPageRR := httptest.NewRecorder()
+	appMux.ServeHTTP(loginPageRR, httptest.NewRequest("GET", "/admin/login", nil))
+	if loginPageRR.Code != http.StatusOK || !strings.Contains(loginPageRR.Body.String(), `href="/admin/auth/google"`) {
+		t.Fatalf("login page does not link to the prefixed auth route: %d", loginPageRR.Code)
+	}
+
+	callbackRR := httptest.NewRecorder()
+	appMux.ServeHTTP(callbackRR, httptest.NewRequest("GET", "/admin/auth/google/callback?state=s&code=c", nil))
+	if location := callbackRR.Header().Get("Location"); location != "/admin/login?error=missing_state" {
+		t.Fatalf("unexpected error redirect %q", location)
+	}
+
+	logoutRR := httptest.NewRecorder()
+	appMux.ServeHTTP(logoutRR, httptest.NewRequest("GET", "/admin/logout", nil))
+	if location := logoutRR.Header().Get("Location"); location != "/admin/login" {
+		t.Fatalf("unexpected logout redirect %q", location)
+	}
+
+	middlewareRR := httptest.NewRecorder()
+	h.AuthMiddleware(http.NotFoundHandler()).ServeHTTP(middlewareRR, httptest.NewRequest("GET", "/admin/reports", nil))
+	if location := middlewareRR.Header().Get("Location"); location != "/admin/login" {
+		t.Fatalf("unexpected middleware redirect %q", location)
+	}
+}
+
+// namedProvider is a Google-like provider with another name.
+type namedProvider struct {
+	GoogleProvider
+	name string
+}
+
+func (provider namedProvider) Name() string {
+	return provider.name
+}
+
+func TestWithAdditionalProvider(t *testing.T) {
+	svc, err := New("id", "secret",
+		WithBaseURL("http://localhost:8080"),
+		WithPathPrefix("/admin"),
+		WithAdditionalProvider(namedProvider{name: "corp-sso"}, "corp-id", "corp-secret", "openid"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.Providers()) != 2 || svc.Providers()[1].Name() != "corp-sso" {
+		t.Fatalf("unexpected providers %v", svc.Providers())
+	}
+	additional := svc.additionalServices[0]
+	if additional.routes.GoogleAuth != "/admin/auth/corp-sso" || additional.config.RedirectURL != "http://localhost:8080/admin/auth/corp-sso/callback" || additional.routes.Login != "/admin/login" {
+		t.Fatalf("unexpected routes %+v", additional.routes)
+	}
+	if additional.config.ClientID != "corp-id" || strings.Join(additional.config.Scopes, " ") != "openid" {
+		t.Fatalf("unexpected client config %+v", additional.config)
+	}
+
+	h, err := NewHandlers(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := h.RegisterRoutes(http.NewServeMux())
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/auth/corp-sso", nil))
+	if rr.Code != http.StatusFound || !strings.Contains(rr.Header().Get("Location"), "client_id=corp-id") {
+		t.Fatalf("unexpected login redirect %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	invalid := []struct {
+		name    string
+		options []Option
+	}{
+		{name: "invalid name", options: []Option{WithAdditionalProvider(namedProvider{name: "Corp SSO"}, "id", "secret")}},
+		{name: "duplicate name", options: []Option{WithAdditionalProvider(GoogleProvider{}, "id", "secret")}},
+		{name: "missing credentials", options: []Option{WithAdditionalProvider(namedProvider{name: "corp"}, "id", "")}},
+		{
+			name:    "Google routes of a non-Google primary",
+			options: []Option{WithProvider(namedProvider{name: "keycloak"}), WithAdditionalProvider(GoogleProvider{}, "id", "secret")},
+		},
+		{
+			name:    "custom primary routes",
+			options: []Option{WithRoutes(Routes{Callback: "/auth/corp/callback"}), WithAdditionalProvider(namedProvider{name: "corp"}, "id", "secret")},
+		},
+	}
+	for _, testCase := range invalid {
+		t.Run(testCase.name, func(t *testing.T) {
+			options := append([]Option{WithBaseURL("http://localhost:8080")}, testCase.options...)
+			if _, err := New("id", "secret", options...); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package gauss
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+// UnauthorizedTemplateName is the template rendered with status 403 when the
+// authorization policy rejects a logged-in user.
+const UnauthorizedTemplateName = "unauthorized.html"
+
+// AuthorizationPolicy decides whether an authenticated user may use the
+// application. Authorize returns false to reject the user and an error when the
+// decision could not be made. Policies are evaluated in Callback before a
+// session is created and again by AuthMiddleware on every request, so they
+// must be safe for concurrent use and should be fast.
+type AuthorizationPolicy interface {
+	Authorize(ctx context.Context, user *GoogleUser) (bool, error)
+}
+
+// AuthorizationPolicyFunc adapts a function to AuthorizationPolicy.
+type AuthorizationPolicyFunc func(ctx context.Context, user *GoogleUser) (bool, error)
+
+// Authorize calls policyFunc.
+func (policyFunc AuthorizationPolicyFunc) Authorize(ctx context.Context, user *GoogleUser) (bool, error) {
+	return policyFunc(ctx, user)
+}
+
+// ListPolicy allows users whose verified email matches an Allow pattern and no
+// Deny pattern. Patterns are exact addresses ("alice@example.com"), whole
+// domains ("*@example.com"), subdomains ("*@*.example.com") or "*" for any
+// verified address. Matching ignores case. Users without a verified email are
+// always rejected.
+type ListPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+// NewListPolicy creates a ListPolicy from allow and deny patterns.
+func NewListPolicy(allow []string, deny []string) *ListPolicy {
+	return &ListPolicy{Allow: allow, Deny: deny}
+}
+
+// Authorize implements AuthorizationPolicy.
+func (listPolicy *ListPolicy) Authorize(_ context.Context, user *GoogleUser) (bool, error) {
+	return evaluateEmailPatterns(user, listPolicy.Allow, listPolicy.Deny), nil
+}
+
+// evaluateEmailPatterns applies allow and deny patterns to user's email.
+func evaluateEmailPatterns(user *GoogleUser, allowPatterns []string, denyPatterns []string) bool {
+	if user == nil || user.Email == "" || !user.EmailVerified {
+		return false
+	}
+	email := strings.ToLower(user.Email)
+	for _, pattern := range denyPatterns {
+		if matchesEmailPattern(pattern, email) {
+			return false
+		}
+	}
+	for _, pattern := range allowPatterns {
+		if matchesEmailPattern(pattern, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesEmailPattern reports whether the lower-case email matches pattern.
+func matchesEmailPattern(pattern string, email string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	switch {
+	case pattern == "":
+		return false
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*@*."):
+		atIndex := strings.LastIndex(email, "@")
+		return atIndex >= 0 && strings.HasSuffix(email[atIndex+1:], pattern[3:])
+	case strings.HasPrefix(pattern, "*@"):
+		atIndex := strings.LastIndex(email, "@")
+		return atIndex >= 0 && email[atIndex+1:] == pattern[2:]
+	default:
+		return email == pattern
+	}
+}
+
+// authorize evaluates the configured policy; without one every user is
+// allowed.
+func (serviceInstance *Service) authorize(ctx context.Context, user *GoogleUser) (bool, error) {
+	if serviceInstance.authorizationPolicy == nil {
+		return true, nil
+	}
+	return serviceInstance.authorizationPolicy.Authorize(ctx, user)
+}
+
+// renderUnauthorized responds with 403 and the unauthorized page for a user
+// the authorization policy rejected.
+func (handlersInstance *Handlers) renderUnauthorized(responseWriter http.ResponseWriter, user *GoogleUser) {
+	handlersInstance.renderForbidden(responseWriter, user, "")
+}
+
+// renderForbidden responds with 403 and the unauthorized page. message
+// replaces the page's default explanation when it is not empty.
+func (handlersInstance *Handlers) renderForbidden(responseWriter http.ResponseWriter, user *GoogleUser, message string) {
+	dataMap := map[string]interface{}{
+		"routes":  handlersInstance.service.routes,
+		"message": message,
+	}
+	if user != nil {
+		dataMap["email"] = user.Email
+	}
+	responseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	responseWriter.WriteHeader(http.StatusForbidden)
+	if executeError := handlersInstance.templates.ExecuteTemplate(responseWriter, UnauthorizedTemplateName, dataMap); executeError != nil {
+		handlersInstance.service.logger.Error("Failed to render unauthorized page", "error", executeError)
+	}
+}
+
+// endSession expires webSession, logging failures.
+func (handlersInstance *Handlers) endSession(responseWriter http.ResponseWriter, request *http.Request, webSession *sessions.Session) {
+	webSession.Options.MaxAge = -1
+	if sessionSaveError := webSession.Save(request, responseWriter); sessionSaveError != nil {
+		handlersInstance.service.logger.Error("Failed to end session", "error", sessionSaveError)
+	}
+}
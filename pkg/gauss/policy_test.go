@@ -0,0 +1,124 @@
+package gauss
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/temirov/GAuss/pkg/constants"
+)
+
+func TestListPolicy(t *testing.T) {
+	listPolicy := NewListPolicy(
+		[]string{"alice@example.com", "*@example.org", "*@*.example.net"},
+		[]string{"intern@example.org"},
+	)
+	testCases := []struct {
+		email    string
+		verified bool
+		allowed  bool
+	}{
+		{"alice@example.com", true, true},
+		{"ALICE@Example.com", true, true},
+		{"bob@example.com", true, false},
+		{"bob@example.org", true, true},
+		{"intern@example.org", true, false},
+		{"carol@eu.example.net", true, true},
+		{"carol@example.net", true, false},
+		{"bob@example.org.evil.com", true, false},
+		{"alice@example.com", false, false},
+		{"", true, false},
+	}
+	for _, testCase := range testCases {
+		user := &GoogleUser{Email: testCase.email, EmailVerified: testCase.verified}
+		allowed, err := listPolicy.Authorize(context.Background(), user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != testCase.allowed {
+			t.Errorf("%q (verified %v): allowed = %v, want %v", testCase.email, testCase.verified, allowed, testCase.allowed)
+		}
+	}
+	if allowed, _ := listPolicy.Authorize(context.Background(), nil); allowed {
+		t.Error("a user without profile must be rejected")
+	}
+}
+
+func TestCallbackRendersUnauthorizedPage(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	h := newProviderHandlers(t, provider, WithAuthorizationPolicy(AuthorizationPolicyFunc(func(ctx context.Context, user *GoogleUser) (bool, error) {
+		return user.Email == "someone-else@example.com", nil
+	})))
+
+	loginRR := httptest.NewRecorder()
+	h.Login(loginRR, httptest.NewRequest("GET", constants.GoogleAuthPath, nil))
+	callbackRR, _ := completeAuthorization(t, h, loginRR, nil)
+
+	if callbackRR.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", callbackRR.Code)
+	}
+	if !strings.Contains(callbackRR.Body.String(), "e@example.com is not allowed") {
+		t.Fatalf("unexpected page: %s", callbackRR.Body.String())
+	}
+	if len(callbackRR.Result().Cookies()) != 0 {
+		t.Fatal("rejected users must not receive a session")
+	}
+}
+
+func TestCallbackPolicyError(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	h := newProviderHandlers(t, provider, WithAuthorizationPolicy(AuthorizationPolicyFunc(func(context.Context, *GoogleUser) (bool, error) {
+		return false, errors.New("directory unavailable")
+	})))
+
+	loginRR := httptest.NewRecorder()
+	h.Login(loginRR, httptest.NewRequest("GET", constants.GoogleAuthPath, nil))
+	callbackRR, _ := completeAuthorization(t, h, loginRR, nil)
+	if location := callbackRR.Header().Get("Location"); location != constants.LoginPath+"?error=authorization_failed" {
+		t.Fatalf("unexpected redirect %q", location)
+	}
+}
+
+func TestAuthMiddlewareReevaluatesPolicy(t *testing.T) {
+	var revoked atomic.Bool
+	provider := newFakeProvider(t, nil)
+	h := newProviderHandlers(t, provider, WithAuthorizationPolicy(AuthorizationPolicyFunc(func(context.Context, *GoogleUser) (bool, error) {
+		return !revoked.Load(), nil
+	})))
+
+	loginRR := httptest.NewRecorder()
+	h.Login(loginRR, httptest.NewRequest("GET", constants.GoogleAuthPath, nil))
+	callbackRR, _ := completeAuthorization(t, h, loginRR, nil)
+	sessionCookies := callbackRR.Result().Cookies()
+
+	protected := h.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	newProtectedRequest := func() *http.Request {
+		req := httptest.NewRequest("GET", "/reports", nil)
+		for _, cookie := range sessionCookies {
+			req.AddCookie(cookie)
+		}
+		return req
+	}
+
+	allowedRR := httptest.NewRecorder()
+	protected.ServeHTTP(allowedRR, newProtectedRequest())
+	if allowedRR.Code != http.StatusNoContent {
+		t.Fatalf("expected the allowed user through, got %d", allowedRR.Code)
+	}
+
+	revoked.Store(true)
+	rejectedRR := httptest.NewRecorder()
+	protected.ServeHTTP(rejectedRR, newProtectedRequest())
+	if rejectedRR.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 once the policy rejects the user, got %d", rejectedRR.Code)
+	}
+	if cookies := rejectedRR.Result().Cookies(); len(cookies) == 0 || cookies[0].MaxAge >= 0 {
+		t.Fatal("the rejected session was not ended")
+	}
+}
@@ -0,0 +1,260 @@
+package gauss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// Provider describes the OAuth 2.0 / OpenID Connect identity provider a Service
+// logs users in with. GoogleProvider is the default; DiscoverOIDCProvider
+// configures any OpenID Connect issuer, such as GitLab or Keycloak.
+type Provider interface {
+	// Name identifies the provider, e.g. "google". It is recorded in the
+	// session and names the routes of additional providers, so it may only
+	// contain lowercase letters, digits, dashes and underscores.
+	Name() string
+	// DisplayName is shown on the login page, e.g. "Google".
+	DisplayName() string
+	// Endpoints returns the provider's URLs. Issuer and JWKSURL are needed to
+	// verify ID tokens; empty RevocationURL and TokenInfoURL disable token
+	// revocation and access token validation.
+	Endpoints() Endpoints
+	// DefaultScopes are requested when the Service is not given WithScopes.
+	DefaultScopes() []string
+	// UserFromClaims maps the claims of an ID token or userinfo response to
+	// a user. The subject must not be empty.
+	UserFromClaims(claims map[string]interface{}) (*GoogleUser, error)
+}
+
+// ClaimsMapper maps ID token or userinfo claims to a user, e.g. to fill Email
+// from a provider specific claim.
+type ClaimsMapper func(claims map[string]interface{}) (*GoogleUser, error)
+
+// StandardClaimsUser maps the standard OpenID Connect claims, plus Google's hd
+// claim, to a user. email_verified is accepted as a boolean or as the string
+// "true".
+func StandardClaimsUser(claims map[string]interface{}) (*GoogleUser, error) {
+	stringClaim := func(name string) string {
+		value, _ := claims[name].(string)
+		return value
+	}
+	emailVerified, _ := claims["email_verified"].(bool)
+	if stringClaim("email_verified") == "true" {
+		emailVerified = true
+	}
+	return &GoogleUser{
+		Subject:       stringClaim("sub"),
+		Email:         stringClaim("email"),
+		EmailVerified: emailVerified,
+		Name:          stringClaim("name"),
+		GivenName:     stringClaim("given_name"),
+		FamilyName:    stringClaim("family_name"),
+		Picture:       stringClaim("picture"),
+		Locale:        stringClaim("locale"),
+		HostedDomain:  stringClaim("hd"),
+	}, nil
+}
+
+// GoogleProvider logs users in with Google accounts. It is the provider of
+// every Service created without WithProvider.
+type GoogleProvider struct{}
+
+// Name returns "google".
+func (GoogleProvider) Name() string {
+	return "google"
+}
+
+// DisplayName returns "Google".
+func (GoogleProvider) DisplayName() string {
+	return "Google"
+}
+
+// Endpoints returns Google's production endpoints.
+func (GoogleProvider) Endpoints() Endpoints {
+	return Endpoints{
+		AuthURL:       google.Endpoint.AuthURL,
+		TokenURL:      google.Endpoint.TokenURL,
+		UserInfoURL:   userInfoEndpoint,
+		JWKSURL:       googleJWKSEndpoint,
+		RevocationURL: GoogleRevocationURL,
+		TokenInfoURL:  GoogleTokenInfoURL,
+		Issuer:        googleIssuers[0],
+		AuthStyle:     google.Endpoint.AuthStyle,
+	}
+}
+
+// DefaultScopes returns DefaultScopes.
+func (GoogleProvider) DefaultScopes() []string {
+	return ScopeStrings(DefaultScopes)
+}
+
+// UserFromClaims maps the claims with StandardClaimsUser.
+func (GoogleProvider) UserFromClaims(claims map[string]interface{}) (*GoogleUser, error) {
+	return StandardClaimsUser(claims)
+}
+
+// OIDCProvider is an OpenID Connect provider configured from its discovery
+// document. Create it with DiscoverOIDCProvider.
+type OIDCProvider struct {
+	name          string
+	displayName   string
+	discovery     *cachedDocument[discoveryDocument]
+	defaultScopes []string
+	claimsMapper  ClaimsMapper
+}
+
+// oidcProviderConfig collects the settings applied by OIDCOptions.
+type oidcProviderConfig struct {
+	name          string
+	displayName   string
+	httpClient    *http.Client
+	defaultScopes []string
+	claimsMapper  ClaimsMapper
+}
+
+// OIDCOption configures a provider created with DiscoverOIDCProvider.
+type OIDCOption func(*oidcProviderConfig)
+
+// WithProviderName sets the provider's Name. It defaults to "oidc".
+func WithProviderName(name string) OIDCOption {
+	return func(config *oidcProviderConfig) {
+		config.name = name
+	}
+}
+
+// WithProviderDisplayName sets the provider's DisplayName. It defaults to the
+// provider's Name.
+func WithProviderDisplayName(displayName string) OIDCOption {
+	return func(config *oidcProviderConfig) {
+		config.displayName = displayName
+	}
+}
+
+// WithDiscoveryHTTPClient sets the client used to fetch the discovery
+// document. It defaults to http.DefaultClient.
+func WithDiscoveryHTTPClient(httpClient *http.Client) OIDCOption {
+	return func(config *oidcProviderConfig) {
+		config.httpClient = httpClient
+	}
+}
+
+// WithProviderScopes sets the provider's DefaultScopes. They default to
+// "openid", "profile" and "email".
+func WithProviderScopes(scopes ...string) OIDCOption {
+	return func(config *oidcProviderConfig) {
+		config.defaultScopes = append([]string(nil), scopes...)
+	}
+}
+
+// WithClaimsMapper replaces StandardClaimsUser for mapping the provider's
+// claims to users.
+func WithClaimsMapper(mapper ClaimsMapper) OIDCOption {
+	return func(config *oidcProviderConfig) {
+		config.claimsMapper = mapper
+	}
+}
+
+// DiscoverOIDCProvider fetches the OpenID Connect discovery document of
+// issuerURL, e.g. "https://gitlab.com" or
+// "https://keycloak.example.com/realms/main", and returns a provider using the
+// endpoints it lists. The document must name issuerURL as its issuer. The
+// provider keeps the document for as long as its Cache-Control header allows
+// and then refetches it in the background, so Services using the provider
+// follow endpoint changes at the issuer.
+func DiscoverOIDCProvider(ctx context.Context, issuerURL string, options ...OIDCOption) (*OIDCProvider, error) {
+	settings := oidcProviderConfig{
+		name:          "oidc",
+		httpClient:    http.DefaultClient,
+		defaultScopes: ScopeStrings(OpenIDScopes),
+		claimsMapper:  StandardClaimsUser,
+	}
+	for _, option := range options {
+		option(&settings)
+	}
+	if issuerURL == "" {
+		return nil, errors.New("missing OpenID Connect issuer URL")
+	}
+	if settings.displayName == "" {
+		settings.displayName = settings.name
+	}
+
+	discovery := newDiscoveryDocument(issuerURL, settings.httpClient)
+	if _, discoveryError := discovery.get(ctx); discoveryError != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", discoveryError)
+	}
+
+	return &OIDCProvider{
+		name:          settings.name,
+		displayName:   settings.displayName,
+		discovery:     discovery,
+		defaultScopes: settings.defaultScopes,
+		claimsMapper:  settings.claimsMapper,
+	}, nil
+}
+
+// tokenAuthStyle picks how to authenticate at the token endpoint from the
+// methods a discovery document lists. Without a list, client_secret_basic is
+// the OpenID Connect default.
+func tokenAuthStyle(methods []string) oauth2.AuthStyle {
+	if len(methods) == 0 || slices.Contains(methods, "client_secret_basic") {
+		return oauth2.AuthStyleInHeader
+	}
+	if slices.Contains(methods, "client_secret_post") {
+		return oauth2.AuthStyleInParams
+	}
+	return oauth2.AuthStyleAutoDetect
+}
+
+// Name returns the name set with WithProviderName.
+func (provider *OIDCProvider) Name() string {
+	return provider.name
+}
+
+// DisplayName returns the name set with WithProviderDisplayName.
+func (provider *OIDCProvider) DisplayName() string {
+	return provider.displayName
+}
+
+// Endpoints returns the endpoints listed in the cached discovery document,
+// starting a refetch when it has expired. Access tokens cannot be validated,
+// as OpenID Connect defines no tokeninfo endpoint.
+func (provider *OIDCProvider) Endpoints() Endpoints {
+	return provider.discovery.current().endpoints()
+}
+
+// DefaultScopes returns the scopes set with WithProviderScopes.
+func (provider *OIDCProvider) DefaultScopes() []string {
+	return append([]string(nil), provider.defaultScopes...)
+}
+
+// UserFromClaims maps the claims with the provider's ClaimsMapper.
+func (provider *OIDCProvider) UserFromClaims(claims map[string]interface{}) (*GoogleUser, error) {
+	return provider.claimsMapper(claims)
+}
+
+// withEndpointOverrides returns endpoints with the non-empty fields of
+// overrides replacing its own.
+func withEndpointOverrides(endpoints Endpoints, overrides Endpoints) Endpoints {
+	replace := func(value *string, override string) {
+		if override != "" {
+			*value = override
+		}
+	}
+	replace(&endpoints.AuthURL, overrides.AuthURL)
+	replace(&endpoints.TokenURL, overrides.TokenURL)
+	replace(&endpoints.UserInfoURL, overrides.UserInfoURL)
+	replace(&endpoints.JWKSURL, overrides.JWKSURL)
+	replace(&endpoints.RevocationURL, overrides.RevocationURL)
+	replace(&endpoints.TokenInfoURL, overrides.TokenInfoURL)
+	replace(&endpoints.Issuer, overrides.Issuer)
+	if overrides.AuthStyle != oauth2.AuthStyleAutoDetect {
+		endpoints.AuthStyle = overrides.AuthStyle
+	}
+	return endpoints
+}
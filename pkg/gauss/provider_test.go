@@ -0,0 +1,150 @@
+package gauss
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestStandardClaimsUser(t *testing.T) {
+	testCases := []struct {
+		name   string
+		claims map[string]interface{}
+		want   GoogleUser
+	}{
+		{
+			name:   "boolean email_verified",
+			claims: map[string]interface{}{"sub": "1", "email": "e@example.com", "email_verified": true, "hd": "example.com"},
+			want:   GoogleUser{Subject: "1", Email: "e@example.com", EmailVerified: true, HostedDomain: "example.com"},
+		},
+		{
+			name:   "string email_verified",
+			claims: map[string]interface{}{"sub": "2", "email_verified": "true", "name": "Tester"},
+			want:   GoogleUser{Subject: "2", EmailVerified: true, Name: "Tester"},
+		},
+		{
+			name:   "unexpected types",
+			claims: map[string]interface{}{"sub": 3, "email_verified": "yes"},
+			want:   GoogleUser{},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			user, err := StandardClaimsUser(testCase.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *user != testCase.want {
+				t.Fatalf("got %+v, want %+v", *user, testCase.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverOIDCProvider(t *testing.T) {
+	server := newFakeProvider(t, nil)
+	provider, err := DiscoverOIDCProvider(context.Background(), server.URL, WithProviderName("keycloak"), WithProviderScopes("openid", "email"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints := provider.Endpoints()
+	if endpoints.TokenURL != server.URL+"/token" || endpoints.Issuer != server.URL || endpoints.RevocationURL != "" || endpoints.AuthStyle != oauth2.AuthStyleInHeader {
+		t.Fatalf("unexpected endpoints %+v", endpoints)
+	}
+	if provider.Name() != "keycloak" || strings.Join(provider.DefaultScopes(), " ") != "openid email" {
+		t.Fatalf("unexpected provider %q %v", provider.Name(), provider.DefaultScopes())
+	}
+
+	svc, err := New("id", "secret", WithBaseURL("http://localhost:8080"), WithProvider(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !svc.OpenIDConnectEnabled() || svc.Provider() != provider || svc.RevokeToken(context.Background(), "token") == nil {
+		t.Fatal("expected an OpenID Connect service without revocation")
+	}
+	if _, err := svc.VerifyBearerToken(context.Background(), "opaque-access-token"); err == nil {
+		t.Fatal("expected opaque access tokens to be rejected without a tokeninfo endpoint")
+	}
+
+	testCases := []struct {
+		name      string
+		issuerURL func(server *fakeProvider) string
+		omitJWKS  bool
+	}{
+		{name: "issuer mismatch", issuerURL: func(server *fakeProvider) string { return server.URL + "/" }},
+		{name: "missing JWKS", issuerURL: func(server *fakeProvider) string { return server.URL }, omitJWKS: true},
+		{name: "not found", issuerURL: func(server *fakeProvider) string { return server.URL + "/realms/missing" }},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			server := newFakeProvider(t, nil)
+			if testCase.omitJWKS {
+				server.publishDiscovery(map[string]interface{}{
+					"issuer":                 "ISSUER",
+					"authorization_endpoint": "ISSUER/auth",
+					"token_endpoint":         "ISSUER/token",
+				})
+			}
+			if _, err := DiscoverOIDCProvider(context.Background(), testCase.issuerURL(server)); err == nil {
+				t.Fatal("expected discovery to fail")
+			}
+		})
+	}
+}
+
+func TestOIDCProviderRefetchesExpiredDiscovery(t *testing.T) {
+	server := newFakeProvider(t, nil)
+	provider, err := DiscoverOIDCProvider(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := New("id", "secret", WithBaseURL("http://localhost:8080"), WithProvider(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.publishDiscovery(map[string]interface{}{
+		"issuer":                 "ISSUER",
+		"authorization_endpoint": "ISSUER/v2/auth",
+		"token_endpoint":         "ISSUER/v2/token",
+		"jwks_uri":               "ISSUER/jwks",
+		"revocation_endpoint":    "ISSUER/v2/revoke",
+	})
+	if tokenURL := svc.oauthConfig().Endpoint.TokenURL; tokenURL != server.URL+"/token" || server.discoveryRequests.Load() != 1 {
+		t.Fatalf("expected the cached document to be used, got %s after %d requests", tokenURL, server.discoveryRequests.Load())
+	}
+
+	provider.discovery.mutex.Lock()
+	provider.discovery.expiresAt = time.Now()
+	provider.discovery.mutex.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for svc.oauthConfig().Endpoint.TokenURL != server.URL+"/v2/token" {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the expired discovery document to be refetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if server.discoveryRequests.Load() != 2 || svc.revocationEndpoint() != server.URL+"/v2/revoke" {
+		t.Fatalf("expected one refetch to update every endpoint, got %d requests and revocation endpoint %q", server.discoveryRequests.Load(), svc.revocationEndpoint())
+	}
+}
+
+func TestTokenAuthStyle(t *testing.T) {
+	testCases := []struct {
+		methods []string
+		want    oauth2.AuthStyle
+	}{
+		{methods: nil, want: oauth2.AuthStyleInHeader},
+		{methods: []string{"client_secret_post", "client_secret_basic"}, want: oauth2.AuthStyleInHeader},
+		{methods: []string{"client_secret_post"}, want: oauth2.AuthStyleInParams},
+		{methods: []string{"private_key_jwt"}, want: oauth2.AuthStyleAutoDetect},
+	}
+	for _, testCase := range testCases {
+		if got := tokenAuthStyle(testCase.methods); got != testCase.want {
+			t.Errorf("tokenAuthStyle(%v) = %v, want %v", testCase.methods, got, testCase.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package gauss
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+	"github.com/temirov/GAuss/pkg/constants"
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrNotAuthenticated is returned when the request carries no logged-in
+	// GAuss session.
+	ErrNotAuthenticated = errors.New("gauss: request is not authenticated")
+	// ErrTokenMissing is returned when the session holds no OAuth token.
+	ErrTokenMissing = errors.New("gauss: oauth token missing from session")
+	// ErrTokenCorrupt is returned when the stored OAuth token cannot be decoded.
+	ErrTokenCorrupt = errors.New("gauss: oauth token in session is corrupt")
+)
+
+// identityContextKey is the context key under which AuthMiddleware stores the
+// authenticated identity.
+type identityContextKey struct{}
+
+// requestIdentity is the authenticated identity attached to a request.
+type requestIdentity struct {
+	user       *GoogleUser
+	provider   string
+	roles      []string
+	token      *oauth2.Token
+	tokenError error
+}
+
+// contextWithIdentity returns a copy of ctx carrying the identity.
+func contextWithIdentity(ctx context.Context, identity *requestIdentity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// identityFromContext returns the identity stored by AuthMiddleware.
+func identityFromContext(ctx context.Context) (*requestIdentity, bool) {
+	identity, found := ctx.Value(identityContextKey{}).(*requestIdentity)
+	return identity, found && identity != nil
+}
+
+// tokenFromSession decodes the OAuth token stored in the session.
+func tokenFromSession(webSession *sessions.Session) (*oauth2.Token, error) {
+	tokenJSON, tokenOk := webSession.Values[constants.SessionKeyOAuthToken].(string)
+	if !tokenOk || tokenJSON == "" {
+		return nil, ErrTokenMissing
+	}
+	var storedToken oauth2.Token
+	if unmarshalError := json.Unmarshal([]byte(tokenJSON), &storedToken); unmarshalError != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenCorrupt, unmarshalError)
+	}
+	return &storedToken, nil
+}
+
+// storeTokenInSession encodes token into the session.
+func storeTokenInSession(webSession *sessions.Session, token *oauth2.Token) error {
+	tokenBytes, marshalError := json.Marshal(token)
+	if marshalError != nil {
+		return fmt.Errorf("failed to marshal token: %w", marshalError)
+	}
+	webSession.Values[constants.SessionKeyOAuthToken] = string(tokenBytes)
+	return nil
+}
+
+// CurrentUser returns the user that AuthMiddleware attached to the request.
+// It returns ErrNotAuthenticated for requests that did not pass through the
+// middleware with a logged-in session. Sessions created with API-only scopes
+// yield a GoogleUser without profile fields.
+func CurrentUser(request *http.Request) (*GoogleUser, error) {
+	identity, found := identityFromContext(request.Context())
+	if !found {
+		return nil, ErrNotAuthenticated
+	}
+	return identity.user, nil
+}
+
+// CurrentProvider returns the Name of the provider the user that
+// AuthMiddleware or BearerMiddleware attached to the request logged in with.
+func CurrentProvider(request *http.Request) (string, error) {
+	identity, found := identityFromContext(request.Context())
+	if !found {
+		return "", ErrNotAuthenticated
+	}
+	return identity.provider, nil
+}
+
+// TokenFromRequest returns the OAuth token of the user that AuthMiddleware
+// attached to the request. It returns ErrNotAuthenticated, ErrTokenMissing or
+// an error wrapping ErrTokenCorrupt. The token is returned as stored; use
+// Handlers.Client or Handlers.TokenSource to refresh it.
+func TokenFromRequest(request *http.Request) (*oauth2.Token, error) {
+	identity, found := identityFromContext(request.Context())
+	if !found {
+		return nil, ErrNotAuthenticated
+	}
+	if identity.tokenError != nil {
+		return nil, identity.tokenError
+	}
+	return identity.token, nil
+}
+
+// CurrentUser reads the logged-in user directly from the handlers' session
+// store, so it also works on routes that are not wrapped by AuthMiddleware.
+func (handlersInstance *Handlers) CurrentUser(request *http.Request) (*GoogleUser, error) {
+	webSession, _ := handlersInstance.store.Get(request, constants.SessionName)
+	googleUser, loggedIn := UserFromSession(webSession)
+	if !loggedIn {
+		return nil, ErrNotAuthenticated
+	}
+	return googleUser, nil
+}
+
+// Token reads the logged-in user's OAuth token directly from the handlers'
+// session store, with the same errors as TokenFromRequest.
+func (handlersInstance *Handlers) Token(request *http.Request) (*oauth2.Token, error) {
+	webSession, _ := handlersInstance.store.Get(request, constants.SessionName)
+	if _, loggedIn := UserFromSession(webSession); !loggedIn {
+		return nil, ErrNotAuthenticated
+	}
+	return tokenFromSession(webSession)
+}
@@ -0,0 +1,86 @@
+package gauss
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/temirov/GAuss/pkg/constants"
+	"golang.org/x/oauth2"
+)
+
+func TestAuthMiddlewareAttachesUserAndToken(t *testing.T) {
+	h := newServiceHandlers(t)
+	storedToken := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}
+	cookie := sessionCookieWithToken(t, h, storedToken)
+
+	var (
+		gotUser  *GoogleUser
+		gotToken *oauth2.Token
+	)
+	protected := h.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if gotUser, err = CurrentUser(r); err != nil {
+			t.Errorf("CurrentUser: %v", err)
+		}
+		if gotToken, err = TokenFromRequest(r); err != nil {
+			t.Errorf("TokenFromRequest: %v", err)
+		}
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	protected.ServeHTTP(httptest.NewRecorder(), req)
+
+	if gotUser == nil || gotUser.Email != "e@example.com" {
+		t.Fatalf("unexpected user: %+v", gotUser)
+	}
+	if gotToken == nil || gotToken.AccessToken != "access" || gotToken.RefreshToken != "refresh" {
+		t.Fatalf("unexpected token: %+v", gotToken)
+	}
+}
+
+func TestCurrentUserWithoutMiddleware(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := CurrentUser(req); !errors.Is(err, ErrNotAuthenticated) {
+		t.Fatalf("expected ErrNotAuthenticated, got %v", err)
+	}
+	if _, err := TokenFromRequest(req); !errors.Is(err, ErrNotAuthenticated) {
+		t.Fatalf("expected ErrNotAuthenticated, got %v", err)
+	}
+}
+
+func TestHandlersTokenErrors(t *testing.T) {
+	h := newServiceHandlers(t)
+
+	newSessionRequest := func(tokenValue interface{}) *http.Request {
+		req := httptest.NewRequest("GET", "/", nil)
+		rr := httptest.NewRecorder()
+		sess, _ := h.store.Get(req, constants.SessionName)
+		sess.Values[constants.SessionKeyUserEmail] = "e@example.com"
+		if tokenValue != nil {
+			sess.Values[constants.SessionKeyOAuthToken] = tokenValue
+		}
+		if err := sess.Save(req, rr); err != nil {
+			t.Fatal(err)
+		}
+		next := httptest.NewRequest("GET", "/", nil)
+		next.AddCookie(rr.Result().Cookies()[0])
+		return next
+	}
+
+	if _, err := h.Token(newSessionRequest(nil)); !errors.Is(err, ErrTokenMissing) {
+		t.Fatalf("expected ErrTokenMissing, got %v", err)
+	}
+	if _, err := h.Token(newSessionRequest("{not json")); !errors.Is(err, ErrTokenCorrupt) {
+		t.Fatalf("expected ErrTokenCorrupt, got %v", err)
+	}
+	if user, err := h.CurrentUser(newSessionRequest(nil)); err != nil || user.Email != "e@example.com" {
+		t.Fatalf("unexpected CurrentUser result: %+v, %v", user, err)
+	}
+	if _, err := h.CurrentUser(httptest.NewRequest("GET", "/", nil)); !errors.Is(err, ErrNotAuthenticated) {
+		t.Fatalf("expected ErrNotAuthenticated, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package gauss
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ReturnToParameter is the query parameter of the Google auth route that names
+// the local URL to return to after a successful login.
+const ReturnToParameter = "return_to"
+
+// maxReturnToLength caps the size of a remembered return-to URL.
+const maxReturnToLength = 2048
+
+// safeReturnTo validates a post-login redirect target. Only same-origin
+// relative references with an absolute path are accepted, which rules out
+// absolute URLs, scheme-relative "//host" URLs and the backslash variants that
+// browsers normalise into them.
+func safeReturnTo(rawReturnTo string) (string, bool) {
+	if rawReturnTo == "" || len(rawReturnTo) > maxReturnToLength {
+		return "", false
+	}
+	if !strings.HasPrefix(rawReturnTo, "/") || strings.HasPrefix(rawReturnTo, "//") {
+		return "", false
+	}
+	for _, character := range rawReturnTo {
+		if character == '\\' || character < 0x20 || character == 0x7f {
+			return "", false
+		}
+	}
+	parsedURL, parseError := url.Parse(rawReturnTo)
+	if parseError != nil || parsedURL.Scheme != "" || parsedURL.Host != "" || parsedURL.User != nil {
+		return "", false
+	}
+	return parsedURL.String(), true
+}
+
+// returnToFromRequest returns the URL of request as a return-to target when
+// navigating back to it after login makes sense, i.e. for GET and HEAD.
+func returnToFromRequest(request *http.Request) (string, bool) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		return "", false
+	}
+	return safeReturnTo(request.URL.RequestURI())
+}
+
+// htmxReturnTo returns the page an HTMX request was issued from, taken from the
+// HX-Current-URL header, when that page belongs to this host.
+func htmxReturnTo(request *http.Request) (string, bool) {
+	currentURL, parseError := url.Parse(request.Header.Get("HX-Current-URL"))
+	if parseError != nil || currentURL.Host != request.Host {
+		return "", false
+	}
+	return safeReturnTo(currentURL.RequestURI())
+}
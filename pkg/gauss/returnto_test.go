@@ -0,0 +1,40 @@
+package gauss
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSafeReturnTo(t *testing.T) {
+	testCases := []struct {
+		raw   string
+		valid bool
+	}{
+		{"/reports/42", true},
+		{"/reports/42?tab=summary#top", true},
+		{"", false},
+		{"reports/42", false},
+		{"https://evil.example/", false},
+		{"//evil.example/", false},
+		{"/\\evil.example/", false},
+		{"/\\/evil.example/", false},
+		{"/reports\r\nSet-Cookie: x=y", false},
+		{"javascript:alert(1)", false},
+	}
+	for _, testCase := range testCases {
+		if _, valid := safeReturnTo(testCase.raw); valid != testCase.valid {
+			t.Errorf("safeReturnTo(%q) valid = %v, want %v", testCase.raw, valid, testCase.valid)
+		}
+	}
+}
+
+func TestAuthMiddlewareIgnoresReturnToForPost(t *testing.T) {
+	h := newServiceHandlers(t)
+	protected := h.AuthMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	rr := httptest.NewRecorder()
+	protected.ServeHTTP(rr, httptest.NewRequest("POST", "/reports/42", nil))
+	if len(rr.Result().Cookies()) != 0 {
+		t.Fatal("POST requests must not be remembered as return-to URLs")
+	}
+}
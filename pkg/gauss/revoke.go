@@ -0,0 +1,80 @@
+package gauss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// GoogleRevocationURL is Google's OAuth 2.0 token revocation endpoint.
+const GoogleRevocationURL = "https://oauth2.googleapis.com/revoke"
+
+// revocationTimeout bounds the revocation call made during logout.
+const revocationTimeout = 10 * time.Second
+
+// RevokeToken revokes an access or refresh token at the service's
+// RevocationURL. Revoking a refresh token also invalidates the access tokens
+// issued with it.
+func (serviceInstance *Service) RevokeToken(ctx context.Context, token string) error {
+	if token == "" {
+		return errors.New("no token to revoke")
+	}
+	revocationURL := serviceInstance.revocationEndpoint()
+	if revocationURL == "" {
+		return errors.New("provider does not support token revocation")
+	}
+
+	form := url.Values{"token": {token}}
+	httpRequest, requestError := http.NewRequestWithContext(ctx, http.MethodPost, revocationURL, strings.NewReader(form.Encode()))
+	if requestError != nil {
+		return fmt.Errorf("failed to build revocation request: %w", requestError)
+	}
+	httpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	httpResponse, httpError := serviceInstance.providerClient().Do(httpRequest)
+	if httpError != nil {
+		return fmt.Errorf("failed to revoke token: %w", httpError)
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(io.LimitReader(httpResponse.Body, 512))
+		return fmt.Errorf("revocation endpoint returned status %d: %s", httpResponse.StatusCode, strings.TrimSpace(string(responseBody)))
+	}
+	return nil
+}
+
+// revokeSessionToken revokes the token stored in webSession in the background,
+// preferring the refresh token, so that logout never waits for Google. Failures
+// are logged.
+func (serviceInstance *Service) revokeSessionToken(ctx context.Context, webSession *sessions.Session) {
+	storedToken, tokenError := tokenFromSession(webSession)
+	if tokenError != nil {
+		if !errors.Is(tokenError, ErrTokenMissing) {
+			serviceInstance.logger.Warn("Skipping token revocation", "error", tokenError)
+		}
+		return
+	}
+	revocableToken := storedToken.RefreshToken
+	if revocableToken == "" {
+		revocableToken = storedToken.AccessToken
+	}
+	if revocableToken == "" {
+		return
+	}
+
+	go func() {
+		revocationContext, cancel := context.WithTimeout(context.WithoutCancel(ctx), revocationTimeout)
+		defer cancel()
+		if revocationError := serviceInstance.RevokeToken(revocationContext, revocableToken); revocationError != nil {
+			serviceInstance.logger.Error("Failed to revoke token on logout", "error", revocationError)
+		}
+	}()
+}
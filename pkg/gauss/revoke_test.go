@@ -0,0 +1,83 @@
+package gauss
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestRevokeToken(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	svc := newProviderHandlers(t, provider).service
+
+	if err := svc.RevokeToken(context.Background(), "refresh-token"); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if got := <-provider.revokedTokens; got != "refresh-token" {
+		t.Fatalf("revoked %q", got)
+	}
+}
+
+func TestRevokeTokenFailure(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	provider.revocationStatus.Store(http.StatusBadRequest)
+	svc := newProviderHandlers(t, provider).service
+
+	if err := svc.RevokeToken(context.Background(), "bad-token"); err == nil {
+		t.Fatal("expected an error for a rejected token")
+	}
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	h := newProviderHandlers(t, provider, WithRevokeOnLogout())
+	cookie := sessionCookieWithToken(t, h, &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"})
+
+	req := httptest.NewRequest("GET", "/logout", nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	h.Logout(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected redirect, got %d", rr.Code)
+	}
+	select {
+	case got := <-provider.revokedTokens:
+		if got != "refresh" {
+			t.Fatalf("revoked %q, want the refresh token", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("token was not revoked")
+	}
+}
+
+func TestLogoutSucceedsWhenRevocationFails(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	provider.revocationStatus.Store(http.StatusInternalServerError)
+	h := newProviderHandlers(t, provider, WithRevokeOnLogout())
+	cookie := sessionCookieWithToken(t, h, &oauth2.Token{AccessToken: "access"})
+
+	req := httptest.NewRequest("GET", "/logout", nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	h.Logout(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected redirect, got %d", rr.Code)
+	}
+	if cookies := rr.Result().Cookies(); len(cookies) == 0 || cookies[0].MaxAge >= 0 {
+		t.Fatalf("session cookie was not expired: %+v", cookies)
+	}
+	select {
+	case got := <-provider.revokedTokens:
+		if got != "access" {
+			t.Fatalf("revoked %q, want the access token", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("revocation was not attempted")
+	}
+}
@@ -0,0 +1,247 @@
+package gauss
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/temirov/GAuss/pkg/constants"
+)
+
+// defaultRoleCacheDuration is how long roles cached in the session are trusted
+// before the RoleResolver is asked again.
+const defaultRoleCacheDuration = 10 * time.Minute
+
+// RoleResolver returns the roles of an authenticated user. user has no profile
+// fields for sessions created with API-only scopes. Implementations must be
+// safe for concurrent use.
+type RoleResolver interface {
+	ResolveRoles(ctx context.Context, user *GoogleUser) ([]string, error)
+}
+
+// RoleResolverFunc adapts a function to RoleResolver.
+type RoleResolverFunc func(ctx context.Context, user *GoogleUser) ([]string, error)
+
+// ResolveRoles calls resolverFunc.
+func (resolverFunc RoleResolverFunc) ResolveRoles(ctx context.Context, user *GoogleUser) ([]string, error) {
+	return resolverFunc(ctx, user)
+}
+
+// StaticRoles maps ListPolicy email patterns to roles. A user receives the
+// roles of every pattern their verified email matches:
+//
+//	gauss.StaticRoles{
+//		"alice@example.com": {"admin"},
+//		"*@example.com":     {"staff"},
+//	}
+type StaticRoles map[string][]string
+
+// ResolveRoles implements RoleResolver.
+func (staticRoles StaticRoles) ResolveRoles(_ context.Context, user *GoogleUser) ([]string, error) {
+	return rolesForPatterns(staticRoles, user), nil
+}
+
+// rolesForPatterns collects the roles of every pattern matching user's
+// verified email, without duplicates and in sorted order.
+func rolesForPatterns(patternRoles map[string][]string, user *GoogleUser) []string {
+	if user == nil || user.Email == "" || !user.EmailVerified {
+		return nil
+	}
+	email := strings.ToLower(user.Email)
+	var roles []string
+	for pattern, patternRoleList := range patternRoles {
+		if matchesEmailPattern(pattern, email) {
+			roles = append(roles, patternRoleList...)
+		}
+	}
+	slices.Sort(roles)
+	return slices.Compact(roles)
+}
+
+// FileRoleResolver is a RoleResolver backed by a text file that is reloaded
+// when it changes. Each line maps an email pattern to comma separated roles;
+// lines starting with "#" are comments:
+//
+//	alice@example.com: admin, billing
+//	*@example.com: staff
+//
+// A file that cannot be read during a reload leaves the previous mapping in
+// effect; the failure is logged to the logger of the Service using it.
+type FileRoleResolver struct {
+	file *watchedFile
+
+	mutex        sync.RWMutex
+	patternRoles map[string][]string
+}
+
+// NewFileRoleResolver loads the role file at path.
+func NewFileRoleResolver(path string) (*FileRoleResolver, error) {
+	fileResolver := &FileRoleResolver{}
+	file, loadError := newWatchedFile(path, fileResolver.parse)
+	if loadError != nil {
+		return nil, loadError
+	}
+	fileResolver.file = file
+	return fileResolver, nil
+}
+
+// setReloadLogger implements reloadLogger.
+func (fileResolver *FileRoleResolver) setReloadLogger(logger *slog.Logger) {
+	fileResolver.file.setLogger(logger)
+}
+
+// ResolveRoles implements RoleResolver, picking up changes to the file.
+func (fileResolver *FileRoleResolver) ResolveRoles(_ context.Context, user *GoogleUser) ([]string, error) {
+	fileResolver.file.reloadIfChanged()
+
+	fileResolver.mutex.RLock()
+	defer fileResolver.mutex.RUnlock()
+	return rolesForPatterns(fileResolver.patternRoles, user), nil
+}
+
+// parse replaces the role mapping with the one in roleFile.
+func (fileResolver *FileRoleResolver) parse(roleFile *os.File) error {
+	patternRoles := make(map[string][]string)
+	scanner := bufio.NewScanner(roleFile)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern, roleList, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		pattern = strings.TrimSpace(pattern)
+		for _, role := range strings.Split(roleList, ",") {
+			if trimmedRole := strings.TrimSpace(role); trimmedRole != "" {
+				patternRoles[pattern] = append(patternRoles[pattern], trimmedRole)
+			}
+		}
+	}
+	if scanError := scanner.Err(); scanError != nil {
+		return scanError
+	}
+
+	fileResolver.mutex.Lock()
+	defer fileResolver.mutex.Unlock()
+	fileResolver.patternRoles = patternRoles
+	return nil
+}
+
+// cacheRoles resolves the roles of googleUser and stores them in the session.
+func (serviceInstance *Service) cacheRoles(ctx context.Context, webSession *sessions.Session, googleUser *GoogleUser) ([]string, error) {
+	roles, resolveError := serviceInstance.roleResolver.ResolveRoles(ctx, googleUser)
+	if resolveError != nil {
+		return nil, resolveError
+	}
+	webSession.Values[constants.SessionKeyUserRoles] = append([]string{}, roles...)
+	webSession.Values[constants.SessionKeyUserRolesResolvedAt] = time.Now().Unix()
+	return roles, nil
+}
+
+// cachedRoles returns the roles cached in the session while they are fresh.
+func (serviceInstance *Service) cachedRoles(webSession *sessions.Session) ([]string, bool) {
+	roles, rolesOk := webSession.Values[constants.SessionKeyUserRoles].([]string)
+	resolvedAt, resolvedOk := webSession.Values[constants.SessionKeyUserRolesResolvedAt].(int64)
+	if !rolesOk || !resolvedOk || time.Since(time.Unix(resolvedAt, 0)) > serviceInstance.roleCacheDuration {
+		return nil, false
+	}
+	return roles, true
+}
+
+// sessionRoles returns the roles cached in webSession, resolving and caching
+// them again once they are stale.
+func (handlersInstance *Handlers) sessionRoles(responseWriter http.ResponseWriter, request *http.Request, webSession *sessions.Session, googleUser *GoogleUser) ([]string, error) {
+	if roles, fresh := handlersInstance.service.cachedRoles(webSession); fresh {
+		return roles, nil
+	}
+	roles, resolveError := handlersInstance.service.cacheRoles(request.Context(), webSession, googleUser)
+	if resolveError != nil {
+		return nil, resolveError
+	}
+	if sessionSaveError := webSession.Save(request, responseWriter); sessionSaveError != nil {
+		requestLogger(handlersInstance.service.logger, request).Error("Failed to cache roles in session", "error", sessionSaveError)
+	}
+	return roles, nil
+}
+
+// CurrentRoles returns the roles of the user that AuthMiddleware attached to
+// the request. It is empty when no RoleResolver is configured.
+func CurrentRoles(request *http.Request) ([]string, error) {
+	identity, found := identityFromContext(request.Context())
+	if !found {
+		return nil, ErrNotAuthenticated
+	}
+	return identity.roles, nil
+}
+
+// RequireRole returns middleware that admits logged-in users holding role. It
+// includes AuthMiddleware, so anonymous users are sent to the login page and
+// users lacking the role receive 403.
+func (handlersInstance *Handlers) RequireRole(role string) func(http.Handler) http.Handler {
+	return handlersInstance.RequireAnyRole(role)
+}
+
+// RequireAnyRole returns middleware that admits logged-in users holding at
+// least one of roles.
+func (handlersInstance *Handlers) RequireAnyRole(roles ...string) func(http.Handler) http.Handler {
+	return handlersInstance.requireRoles(func(userRoles []string) bool {
+		for _, role := range roles {
+			if slices.Contains(userRoles, role) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RequireAllRoles returns middleware that admits logged-in users holding every
+// one of roles.
+func (handlersInstance *Handlers) RequireAllRoles(roles ...string) func(http.Handler) http.Handler {
+	return handlersInstance.requireRoles(func(userRoles []string) bool {
+		for _, role := range roles {
+			if !slices.Contains(userRoles, role) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// requireRoles builds role middleware around AuthMiddleware from a predicate
+// over the user's roles.
+func (handlersInstance *Handlers) requireRoles(satisfied func(userRoles []string) bool) func(http.Handler) http.Handler {
+	return func(nextHandler http.Handler) http.Handler {
+		return handlersInstance.AuthMiddleware(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+			userRoles, _ := CurrentRoles(request)
+			if !satisfied(userRoles) {
+				requestLogger(handlersInstance.service.logger, request).Warn("Missing required role", "event", "role_denied", "path", request.URL.Path)
+				handlersInstance.respondForbidden(responseWriter, request)
+				return
+			}
+			nextHandler.ServeHTTP(responseWriter, request)
+		}))
+	}
+}
+
+// respondForbidden answers a logged-in user lacking a role with 403, as JSON
+// for API clients and as the unauthorized page otherwise.
+func (handlersInstance *Handlers) respondForbidden(responseWriter http.ResponseWriter, request *http.Request) {
+	if isAPIRequest(request, handlersInstance.service.apiPathPrefixes) {
+		writeJSONError(responseWriter, http.StatusForbidden, apiErrorResponse{
+			Error:   "forbidden",
+			Message: "You do not have permission to access this resource.",
+		})
+		return
+	}
+	googleUser, _ := CurrentUser(request)
+	handlersInstance.renderForbidden(responseWriter, googleUser, "You do not have permission to access this page.")
+}
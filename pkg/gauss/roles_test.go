@@ -0,0 +1,173 @@
+package gauss
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/temirov/GAuss/pkg/constants"
+)
+
+func TestStaticRoles(t *testing.T) {
+	staticRoles := StaticRoles{
+		"alice@example.com": {"admin", "staff"},
+		"*@example.com":     {"staff"},
+	}
+	roles, err := staticRoles.ResolveRoles(context.Background(), &GoogleUser{Email: "Alice@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(roles, []string{"admin", "staff"}) {
+		t.Fatalf("unexpected roles %v", roles)
+	}
+	if roles, _ := staticRoles.ResolveRoles(context.Background(), &GoogleUser{Email: "alice@example.com"}); len(roles) != 0 {
+		t.Fatalf("unverified emails must not receive roles, got %v", roles)
+	}
+}
+
+func TestFileRoleResolver(t *testing.T) {
+	rolePath := filepath.Join(t.TempDir(), "roles.txt")
+	if err := os.WriteFile(rolePath, []byte("# roles\nalice@example.com: admin, billing\n*@example.com: staff\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fileResolver, err := NewFileRoleResolver(rolePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileResolver.file.checkInterval = 0
+	alice := &GoogleUser{Email: "alice@example.com", EmailVerified: true}
+
+	roles, _ := fileResolver.ResolveRoles(context.Background(), alice)
+	if !reflect.DeepEqual(roles, []string{"admin", "billing", "staff"}) {
+		t.Fatalf("unexpected roles %v", roles)
+	}
+
+	if err := os.WriteFile(rolePath, []byte("alice@example.com: auditor\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(rolePath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	roles, _ = fileResolver.ResolveRoles(context.Background(), alice)
+	if !reflect.DeepEqual(roles, []string{"auditor"}) {
+		t.Fatalf("role file changes were not picked up: %v", roles)
+	}
+}
+
+// loginWithRoles logs the fake provider user in and returns the
+// session cookies.
+func loginWithRoles(t *testing.T, h *Handlers) []*http.Cookie {
+	t.Helper()
+	loginRR := httptest.NewRecorder()
+	h.Login(loginRR, httptest.NewRequest("GET", constants.GoogleAuthPath, nil))
+	callbackRR, _ := completeAuthorization(t, h, loginRR, nil)
+	if location := callbackRR.Header().Get("Location"); location != "/dashboard" {
+		t.Fatalf("login failed, redirected to %q", location)
+	}
+	return callbackRR.Result().Cookies()
+}
+
+func TestRequireRole(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	h := newProviderHandlers(t, provider, WithRoleResolver(RoleResolverFunc(func(ctx context.Context, user *GoogleUser) ([]string, error) {
+		if user.Subject == "42" {
+			return []string{"admin", "staff"}, nil
+		}
+		return nil, nil
+	})))
+	cookies := loginWithRoles(t, h)
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roles, err := CurrentRoles(r)
+		if err != nil || !reflect.DeepEqual(roles, []string{"admin", "staff"}) {
+			t.Errorf("CurrentRoles = %v, %v", roles, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	serve := func(middleware func(http.Handler) http.Handler, withCookies bool, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		if withCookies {
+			for _, cookie := range cookies {
+				req.AddCookie(cookie)
+			}
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		middleware(okHandler).ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve(h.RequireRole("admin"), true, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("admin was rejected: %d", rr.Code)
+	}
+	if rr := serve(h.RequireAnyRole("billing", "staff"), true, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("RequireAnyRole rejected a staff user: %d", rr.Code)
+	}
+	if rr := serve(h.RequireAllRoles("admin", "billing"), true, ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("RequireAllRoles admitted a user without billing: %d", rr.Code)
+	}
+
+	htmlRR := serve(h.RequireRole("billing"), true, "text/html")
+	if htmlRR.Code != http.StatusForbidden || !strings.Contains(htmlRR.Body.String(), "permission") {
+		t.Fatalf("expected the HTML 403 page, got %d", htmlRR.Code)
+	}
+	jsonRR := serve(h.RequireRole("billing"), true, "application/json")
+	var body map[string]string
+	if jsonRR.Code != http.StatusForbidden || json.Unmarshal(jsonRR.Body.Bytes(), &body) != nil || body["error"] != "forbidden" {
+		t.Fatalf("expected a JSON 403, got %d %s", jsonRR.Code, jsonRR.Body.String())
+	}
+
+	if rr := serve(h.RequireRole("admin"), false, ""); rr.Code != http.StatusFound {
+		t.Fatalf("anonymous users must be redirected to login, got %d", rr.Code)
+	}
+}
+
+func TestRolesCachedInSession(t *testing.T) {
+	for _, testCase := range []struct {
+		name          string
+		cacheTTL      time.Duration
+		expectedCalls int32
+	}{
+		{"fresh cache", time.Hour, 1},
+		{"expired cache", time.Nanosecond, 3},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			var resolveCalls atomic.Int32
+			provider := newFakeProvider(t, nil)
+			h := newProviderHandlers(t, provider,
+				WithRoleCacheTTL(testCase.cacheTTL),
+				WithRoleResolver(RoleResolverFunc(func(context.Context, *GoogleUser) ([]string, error) {
+					resolveCalls.Add(1)
+					return []string{"admin"}, nil
+				})),
+			)
+			cookies := loginWithRoles(t, h)
+			protected := h.RequireRole("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			for range 2 {
+				req := httptest.NewRequest("GET", "/admin", nil)
+				for _, cookie := range cookies {
+					req.AddCookie(cookie)
+				}
+				rr := httptest.NewRecorder()
+				protected.ServeHTTP(rr, req)
+				if rr.Code != http.StatusOK {
+					t.Fatalf("unexpected status %d", rr.Code)
+				}
+			}
+			if got := resolveCalls.Load(); got != testCase.expectedCalls {
+				t.Fatalf("resolver called %d times, want %d", got, testCase.expectedCalls)
+			}
+		})
+	}
+}
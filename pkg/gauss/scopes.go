@@ -4,6 +4,9 @@ package gauss
 type Scope string
 
 const (
+	// ScopeOpenID enables OpenID Connect; Google then returns a signed ID token
+	// that GAuss verifies instead of calling the userinfo endpoint.
+	ScopeOpenID Scope = "openid"
 	// ScopeEmail allows retrieving the user's email address.
 	ScopeEmail Scope = "email"
 	// ScopeProfile allows retrieving basic profile information.
@@ -15,6 +18,10 @@ const (
 // DefaultScopes lists the scopes used when none are provided to NewService.
 var DefaultScopes = []Scope{ScopeProfile, ScopeEmail}
 
+// OpenIDScopes lists the scopes for an OpenID Connect login that still
+// receives the user's email and basic profile.
+var OpenIDScopes = []Scope{ScopeOpenID, ScopeProfile, ScopeEmail}
+
 // ScopeStrings converts a slice of Scope values into their string representations.
 func ScopeStrings(scopes []Scope) []string {
 	out := make([]string, len(scopes))
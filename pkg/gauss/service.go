@@ -7,72 +7,414 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
+	"sync"
+	"time"
 
-	"github.com/temirov/GAuss/pkg/constants"
+	"github.com/gorilla/sessions"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
 // userInfoEndpoint specifies the URL used to retrieve profile information from
 // Google. It is a variable rather than a constant so tests can replace it with
-// a mock server endpoint.
-var userInfoEndpoint = "https://www.googleapis.com/oauth2/v2/userinfo"
+// a mock server endpoint. The OpenID Connect flavour of the endpoint is used
+// because it reports the stable "sub" identifier and "email_verified".
+var userInfoEndpoint = "https://openidconnect.googleapis.com/v1/userinfo"
 
-// GoogleUser represents a user profile retrieved from Google.
+// GoogleUser represents a user profile retrieved from Google or, despite its
+// name, from the Service's other Provider.
+//
+// Subject is the immutable account ID and is the value applications should
+// key their accounts on; emails can change and may be unverified.
+// HostedDomain is only set for Google Workspace accounts.
 type GoogleUser struct {
-	Email   string `json:"email"`
-	Name    string `json:"name"`
-	Picture string `json:"picture"`
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+	Locale        string `json:"locale"`
+	HostedDomain  string `json:"hd"`
 }
 
 // Service encapsulates OAuth2 configuration and redirection settings used by
-// GAuss. It generates the authorization URL, validates callbacks and provides
-// helper methods for retrieving the authenticated user's profile.
+// GAuss for one Provider, Google unless WithProvider chooses another. It
+// generates the authorization URL, validates callbacks and provides helper
+// methods for retrieving the authenticated user's profile. Create it with New.
 //
 // The LoginTemplate field, if non-empty, specifies the HTML template filename
 // to be used for the login page instead of the embedded "login.html".
+//
+// The SessionStore field, if non-nil, is the store Handlers use for this
+// service. When it is nil Handlers fall back to the global store created with
+// session.NewSession. Set it before calling NewHandlers.
+//
+// When RevokeOnLogout is true, Logout revokes the session's OAuth token at
+// RevocationURL, which defaults to the provider's revocation endpoint.
+//
+// The endpoints follow the provider: when its Endpoints change, e.g. after an
+// OIDCProvider refetched its discovery document, the Service switches to them.
 type Service struct {
-	config           *oauth2.Config
-	localRedirectURL string
-	LoginTemplate    string
+	endpointMutex        sync.RWMutex
+	providerEndpoints    Endpoints
+	endpointOverrides    Endpoints
+	config               *oauth2.Config
+	provider             Provider
+	additionalServices   []*Service
+	localRedirectURL     string
+	userInfoURL          string
+	routes               Routes
+	prompt               Prompt
+	accessType           AccessType
+	refreshTokenLookup   RefreshTokenLookup
+	allowedHostedDomains []string
+	authorizationPolicy  AuthorizationPolicy
+	roleResolver         RoleResolver
+	roleCacheDuration    time.Duration
+	apiPathPrefixes      []string
+	bearerAudiences      []string
+	tokenInfoURL         string
+	bearerTokens         *bearerCache
+	loginHooks           []LoginHook
+	logoutHooks          []LogoutHook
+	authErrorHooks       []AuthErrorHook
+	httpClient           *http.Client
+	logger               *slog.Logger
+	idTokenVerifier      *idTokenVerifier
+	refresher            *tokenRefresher
+	LoginTemplate        string
+	SessionStore         sessions.Store
+	RevokeOnLogout       bool
+	RevocationURL        string
 }
 
-// NewService initializes a Service with Google OAuth credentials and the local
-// redirect URL where authenticated users will be sent after logging in.
-// googleOAuthBase should point to the publicly reachable URL of your GAuss
-// application (e.g. "http://localhost:8080"). customLoginTemplate may specify
-// a login template file to override the default.
-func NewService(clientID string, clientSecret string, googleOAuthBase string, localRedirectURL string, scopes []string, customLoginTemplate string) (*Service, error) {
+// New creates a Service for the given OAuth client of Google or of the
+// Provider chosen with WithProvider. WithBaseURL is required; every other
+// setting has a default:
+//
+//	svc, err := gauss.New(clientID, clientSecret,
+//		gauss.WithBaseURL("https://example.com"),
+//		gauss.WithPostLoginURL("/dashboard"),
+//		gauss.WithScopes(gauss.ScopeStrings(gauss.OpenIDScopes)...),
+//	)
+func New(clientID string, clientSecret string, options ...Option) (*Service, error) {
 	if clientID == "" || clientSecret == "" {
-		return nil, errors.New("missing Google OAuth credentials")
+		return nil, errors.New("missing OAuth client credentials")
 	}
 
-	baseURL, googleOAuthBaseErr := url.Parse(googleOAuthBase)
-	if googleOAuthBaseErr != nil {
-		return nil, errors.New("invalid Google OAuth base URL")
+	settings := serviceConfig{
+		postLoginURL: "/",
+		accessType:   AccessTypeOffline,
+	}
+	for _, option := range options {
+		option(&settings)
+	}
+	if !settings.promptConfigured && settings.accessType == AccessTypeOffline {
+		settings.prompt = PromptConsent
+	}
+
+	serviceInstance, buildError := buildService(clientID, clientSecret, settings)
+	if buildError != nil {
+		return nil, buildError
+	}
+	providerNames := []string{serviceInstance.provider.Name()}
+	for _, additional := range settings.additionalProviders {
+		if additional.provider == nil || additional.clientID == "" || additional.clientSecret == "" {
+			return nil, errors.New("missing additional provider or its OAuth client credentials")
+		}
+		providerName := additional.provider.Name()
+		if !validProviderName(providerName) {
+			return nil, fmt.Errorf("invalid provider name %q", providerName)
+		}
+		if slices.Contains(providerNames, providerName) {
+			return nil, fmt.Errorf("duplicate provider name %q", providerName)
+		}
+		providerNames = append(providerNames, providerName)
+
+		providerSettings := settings
+		providerSettings.provider = additional.provider
+		providerSettings.scopes = additional.scopes
+		providerSettings.endpoints = Endpoints{}
+		if _, isGoogle := additional.provider.(GoogleProvider); !isGoogle {
+			// Only Google asserts the hd claim the restriction checks.
+			providerSettings.hostedDomains = nil
+		}
+		providerSettings.routes = Routes{
+			Login:      settings.routes.Login,
+			GoogleAuth: "/auth/" + providerName,
+			Callback:   "/auth/" + providerName + "/callback",
+			Logout:     settings.routes.Logout,
+		}
+		additionalService, additionalError := buildService(additional.clientID, additional.clientSecret, providerSettings)
+		if additionalError != nil {
+			return nil, additionalError
+		}
+		if routesConflict(serviceInstance.routes, additionalService.routes) {
+			return nil, fmt.Errorf("routes of provider %q conflict with the routes of provider %q", providerName, serviceInstance.provider.Name())
+		}
+		serviceInstance.additionalServices = append(serviceInstance.additionalServices, additionalService)
+	}
+	return serviceInstance, nil
+}
+
+// routesConflict reports whether the login or callback route of an additional
+// provider is also served for the primary provider.
+func routesConflict(primary Routes, additional Routes) bool {
+	primaryPaths := []string{primary.Login, primary.GoogleAuth, primary.Callback, primary.Logout}
+	return slices.Contains(primaryPaths, additional.GoogleAuth) || slices.Contains(primaryPaths, additional.Callback)
+}
+
+// validProviderName reports whether name can be used in provider routes.
+func validProviderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, character := range name {
+		if (character < 'a' || character > 'z') && (character < '0' || character > '9') && character != '-' && character != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// buildService creates the Service for one provider from the collected
+// settings.
+func buildService(clientID string, clientSecret string, settings serviceConfig) (*Service, error) {
+	if settings.baseURL == "" {
+		return nil, errors.New("missing application base URL")
+	}
+	baseURL, baseURLError := url.Parse(settings.baseURL)
+	if baseURLError != nil {
+		return nil, errors.New("invalid application base URL")
+	}
+	routes := settings.routes.withDefaults().withPrefix(settings.pathPrefix)
+	relativePath, callbackPathError := url.Parse(routes.Callback)
+	if callbackPathError != nil {
+		return nil, fmt.Errorf("invalid callback path %q", routes.Callback)
 	}
-	relativePath, _ := url.Parse(constants.CallbackPath)
 	redirectURL := baseURL.ResolveReference(relativePath)
 
+	provider := settings.provider
+	if provider == nil {
+		provider = GoogleProvider{}
+	}
+	providerEndpoints := provider.Endpoints()
+	endpoints := withEndpointOverrides(providerEndpoints, settings.endpoints)
+	if endpoints.AuthURL == "" || endpoints.TokenURL == "" {
+		return nil, fmt.Errorf("provider %q has no authorization or token endpoint", provider.Name())
+	}
+
+	scopes := settings.scopes
 	if len(scopes) == 0 {
-		scopes = ScopeStrings(DefaultScopes)
+		scopes = provider.DefaultScopes()
+	}
+	roleCacheDuration := settings.roleCacheDuration
+	if roleCacheDuration <= 0 {
+		roleCacheDuration = defaultRoleCacheDuration
+	}
+	logger := settings.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = newRedactingLogger(logger)
+	for _, component := range []any{settings.authorizationPolicy, settings.roleResolver} {
+		if fileComponent, watchesFile := component.(reloadLogger); watchesFile {
+			fileComponent.setReloadLogger(logger)
+		}
 	}
 
 	return &Service{
+		providerEndpoints: providerEndpoints,
+		endpointOverrides: settings.endpoints,
 		config: &oauth2.Config{
 			RedirectURL:  redirectURL.String(),
 			ClientID:     clientID,
 			ClientSecret: clientSecret,
 			Scopes:       scopes,
-			Endpoint:     google.Endpoint,
+			Endpoint:     oauth2.Endpoint{AuthURL: endpoints.AuthURL, TokenURL: endpoints.TokenURL, AuthStyle: endpoints.AuthStyle},
 		},
-		localRedirectURL: localRedirectURL,
-		LoginTemplate:    customLoginTemplate,
+		provider:             provider,
+		localRedirectURL:     settings.postLoginURL,
+		userInfoURL:          endpoints.UserInfoURL,
+		routes:               routes,
+		prompt:               settings.prompt,
+		accessType:           settings.accessType,
+		refreshTokenLookup:   settings.refreshTokenLookup,
+		allowedHostedDomains: settings.hostedDomains,
+		authorizationPolicy:  settings.authorizationPolicy,
+		roleResolver:         settings.roleResolver,
+		roleCacheDuration:    roleCacheDuration,
+		apiPathPrefixes:      normalizePathPrefixes(settings.apiPathPrefixes),
+		bearerAudiences:      append([]string{clientID}, settings.bearerAudiences...),
+		tokenInfoURL:         endpoints.TokenInfoURL,
+		bearerTokens:         newBearerCache(),
+		loginHooks:           settings.loginHooks,
+		logoutHooks:          settings.logoutHooks,
+		authErrorHooks:       settings.authErrorHooks,
+		httpClient:           settings.httpClient,
+		logger:               logger,
+		idTokenVerifier:      newIDTokenVerifier(clientID, endpoints, settings.httpClient),
+		refresher:            newTokenRefresher(),
+		LoginTemplate:        settings.loginTemplate,
+		SessionStore:         settings.sessionStore,
+		RevokeOnLogout:       settings.revokeOnLogout,
+		RevocationURL:        endpoints.RevocationURL,
 	}, nil
 }
 
+// resolveEndpoints switches the service to the provider's current endpoints
+// when they differ from the ones it was built with. RevocationURL is only
+// replaced while it still holds the provider's previous revocation endpoint.
+func (serviceInstance *Service) resolveEndpoints() {
+	providerEndpoints := serviceInstance.provider.Endpoints()
+	serviceInstance.endpointMutex.RLock()
+	unchanged := providerEndpoints == serviceInstance.providerEndpoints
+	serviceInstance.endpointMutex.RUnlock()
+	if unchanged {
+		return
+	}
+
+	serviceInstance.endpointMutex.Lock()
+	defer serviceInstance.endpointMutex.Unlock()
+	if providerEndpoints == serviceInstance.providerEndpoints {
+		return
+	}
+	previous := withEndpointOverrides(serviceInstance.providerEndpoints, serviceInstance.endpointOverrides)
+	endpoints := withEndpointOverrides(providerEndpoints, serviceInstance.endpointOverrides)
+	if endpoints.AuthURL == "" || endpoints.TokenURL == "" {
+		return
+	}
+
+	config := *serviceInstance.config
+	config.Endpoint = oauth2.Endpoint{AuthURL: endpoints.AuthURL, TokenURL: endpoints.TokenURL, AuthStyle: endpoints.AuthStyle}
+	serviceInstance.config = &config
+	serviceInstance.userInfoURL = endpoints.UserInfoURL
+	serviceInstance.tokenInfoURL = endpoints.TokenInfoURL
+	if endpoints.JWKSURL != previous.JWKSURL || endpoints.Issuer != previous.Issuer {
+		serviceInstance.idTokenVerifier = newIDTokenVerifier(config.ClientID, endpoints, serviceInstance.httpClient)
+	}
+	if serviceInstance.RevocationURL == previous.RevocationURL {
+		serviceInstance.RevocationURL = endpoints.RevocationURL
+	}
+	serviceInstance.providerEndpoints = providerEndpoints
+}
+
+// oauthConfig returns the OAuth2 configuration for the provider's current
+// endpoints.
+func (serviceInstance *Service) oauthConfig() *oauth2.Config {
+	serviceInstance.resolveEndpoints()
+	serviceInstance.endpointMutex.RLock()
+	defer serviceInstance.endpointMutex.RUnlock()
+	return serviceInstance.config
+}
+
+// userInfoEndpoint returns the provider's current userinfo endpoint.
+func (serviceInstance *Service) userInfoEndpoint() string {
+	serviceInstance.resolveEndpoints()
+	serviceInstance.endpointMutex.RLock()
+	defer serviceInstance.endpointMutex.RUnlock()
+	return serviceInstance.userInfoURL
+}
+
+// tokenInfoEndpoint returns the provider's current tokeninfo endpoint.
+func (serviceInstance *Service) tokenInfoEndpoint() string {
+	serviceInstance.resolveEndpoints()
+	serviceInstance.endpointMutex.RLock()
+	defer serviceInstance.endpointMutex.RUnlock()
+	return serviceInstance.tokenInfoURL
+}
+
+// revocationEndpoint returns RevocationURL, following the provider's
+// revocation endpoint unless it was replaced.
+func (serviceInstance *Service) revocationEndpoint() string {
+	serviceInstance.resolveEndpoints()
+	serviceInstance.endpointMutex.RLock()
+	defer serviceInstance.endpointMutex.RUnlock()
+	return serviceInstance.RevocationURL
+}
+
+// verifier returns the ID token verifier for the provider's current issuer
+// and signing keys.
+func (serviceInstance *Service) verifier() *idTokenVerifier {
+	serviceInstance.resolveEndpoints()
+	serviceInstance.endpointMutex.RLock()
+	defer serviceInstance.endpointMutex.RUnlock()
+	return serviceInstance.idTokenVerifier
+}
+
+// NewService initializes a Service with Google OAuth credentials and the local
+// redirect URL where authenticated users will be sent after logging in.
+// googleOAuthBase should point to the publicly reachable URL of your GAuss
+// application (e.g. "http://localhost:8080"). customLoginTemplate may specify
+// a login template file to override the default.
+//
+// NewService is kept for compatibility; New accepts the same settings as
+// options and supports the newer ones.
+func NewService(clientID string, clientSecret string, googleOAuthBase string, localRedirectURL string, scopes []string, customLoginTemplate string) (*Service, error) {
+	return New(clientID, clientSecret,
+		WithBaseURL(googleOAuthBase),
+		WithPostLoginURL(localRedirectURL),
+		WithScopes(scopes...),
+		WithLoginTemplate(customLoginTemplate),
+	)
+}
+
+// Provider returns the primary identity provider the service logs users in
+// with.
+func (serviceInstance *Service) Provider() Provider {
+	return serviceInstance.provider
+}
+
+// Providers returns the primary provider followed by those added with
+// WithAdditionalProvider.
+func (serviceInstance *Service) Providers() []Provider {
+	providers := []Provider{serviceInstance.provider}
+	for _, additionalService := range serviceInstance.additionalServices {
+		providers = append(providers, additionalService.provider)
+	}
+	return providers
+}
+
+// Routes returns the paths at which the service's Handlers serve the login
+// flow, e.g. for linking to the logout route from application templates.
+func (serviceInstance *Service) Routes() Routes {
+	return serviceInstance.routes
+}
+
+// providerContext returns ctx carrying the configured HTTP client for the
+// oauth2 package.
+func (serviceInstance *Service) providerContext(ctx context.Context) context.Context {
+	if serviceInstance.httpClient == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, serviceInstance.httpClient)
+}
+
+// providerClient returns the configured HTTP client for unauthenticated calls
+// to the provider.
+func (serviceInstance *Service) providerClient() *http.Client {
+	if serviceInstance.httpClient == nil {
+		return http.DefaultClient
+	}
+	return serviceInstance.httpClient
+}
+
+// OpenIDConnectEnabled reports whether the service requests the "openid" scope
+// and therefore verifies the ID token returned with each login.
+func (serviceInstance *Service) OpenIDConnectEnabled() bool {
+	for _, scope := range serviceInstance.oauthConfig().Scopes {
+		if scope == string(ScopeOpenID) {
+			return true
+		}
+	}
+	return false
+}
+
 // GenerateState returns a cryptographically secure random string that is used
 // as the OAuth2 state parameter to protect against cross-site request forgery.
 func (serviceInstance *Service) GenerateState() (string, error) {
@@ -84,30 +426,77 @@ func (serviceInstance *Service) GenerateState() (string, error) {
 	return base64.URLEncoding.EncodeToString(randomBytes), nil
 }
 
-// GetUser contacts Google's userinfo endpoint to retrieve the profile
+// GenerateCodeVerifier returns a PKCE code verifier as described in RFC 7636.
+// It calls oauth2.GenerateVerifier, which encodes 32 random bytes as 43
+// base64url characters and panics when the system's random source fails. The
+// verifier is kept in the session during the login and its S256 challenge is
+// sent with the authorization request.
+func (serviceInstance *Service) GenerateCodeVerifier() string {
+	return oauth2.GenerateVerifier()
+}
+
+// GetUser contacts the provider's userinfo endpoint to retrieve the profile
 // associated with the provided OAuth2 token.
 func (serviceInstance *Service) GetUser(oauthToken *oauth2.Token) (*GoogleUser, error) {
-	httpClient := serviceInstance.config.Client(context.Background(), oauthToken)
-	httpResponse, httpError := httpClient.Get(userInfoEndpoint)
+	return serviceInstance.fetchUser(context.Background(), oauthToken)
+}
+
+// fetchUser implements GetUser for a request bound to ctx.
+func (serviceInstance *Service) fetchUser(ctx context.Context, oauthToken *oauth2.Token) (*GoogleUser, error) {
+	userInfoURL := serviceInstance.userInfoEndpoint()
+	if userInfoURL == "" {
+		return nil, fmt.Errorf("provider %q has no userinfo endpoint", serviceInstance.provider.Name())
+	}
+	httpRequest, requestError := http.NewRequestWithContext(ctx, http.MethodGet, userInfoURL, nil)
+	if requestError != nil {
+		return nil, fmt.Errorf("failed to build user info request: %w", requestError)
+	}
+	httpClient := serviceInstance.oauthConfig().Client(serviceInstance.providerContext(ctx), oauthToken)
+	httpResponse, httpError := httpClient.Do(httpRequest)
 	if httpError != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", httpError)
 	}
 	defer httpResponse.Body.Close()
 
 	if httpResponse.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("google API returned status %d", httpResponse.StatusCode)
+		return nil, fmt.Errorf("userinfo endpoint returned status %d", httpResponse.StatusCode)
 	}
 
-	var user GoogleUser
-	if decodeError := json.NewDecoder(httpResponse.Body).Decode(&user); decodeError != nil {
+	var claims map[string]interface{}
+	if decodeError := json.NewDecoder(httpResponse.Body).Decode(&claims); decodeError != nil {
 		return nil, fmt.Errorf("failed to decode user info: %w", decodeError)
 	}
+	return serviceInstance.provider.UserFromClaims(claims)
+}
 
-	return &user, nil
+// userFromClaims maps verified ID token claims to a user with the provider.
+func (serviceInstance *Service) userFromClaims(claims *idTokenClaims) (*GoogleUser, error) {
+	user, mapError := serviceInstance.provider.UserFromClaims(claims.raw)
+	if mapError != nil {
+		return nil, fmt.Errorf("failed to map id token claims: %w", mapError)
+	}
+	if user.Subject == "" {
+		user.Subject = claims.Subject
+	}
+	return user, nil
+}
+
+// VerifyIDToken validates an ID token against the provider's cached signing keys and
+// checks its issuer, audience, expiry and nonce before returning the user
+// described by its claims. An empty expectedNonce skips the nonce comparison and
+// must only be used for tokens that did not originate from a GAuss login.
+func (serviceInstance *Service) VerifyIDToken(ctx context.Context, rawIDToken string, expectedNonce string) (*GoogleUser, error) {
+	claims, verifyError := serviceInstance.verifier().verify(ctx, rawIDToken, expectedNonce)
+	if verifyError != nil {
+		return nil, fmt.Errorf("failed to verify id token: %w", verifyError)
+	}
+	return serviceInstance.userFromClaims(claims)
 }
 
 // GetClient creates an authenticated http.Client using the service's OAuth2
-// configuration and the provided token.
+// configuration and the provided token. The client refreshes an expired token
+// but does not persist the result; use Handlers.Client to write refreshed
+// tokens back to the session.
 func (serviceInstance *Service) GetClient(ctx context.Context, token *oauth2.Token) *http.Client {
-	return serviceInstance.config.Client(ctx, token)
+	return serviceInstance.oauthConfig().Client(serviceInstance.providerContext(ctx), token)
 }
@@ -0,0 +1,187 @@
+package gauss
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/temirov/GAuss/pkg/constants"
+	"golang.org/x/oauth2"
+)
+
+// refreshEntrySweepInterval is how often the tokenRefresher drops entries
+// whose remembered token has expired.
+const refreshEntrySweepInterval = time.Minute
+
+// refreshEntry serializes refreshes of one refresh token and remembers the
+// most recent access token obtained with it. latest is guarded by mutex;
+// references and keepUntil are guarded by the tokenRefresher's mutex.
+type refreshEntry struct {
+	mutex  sync.Mutex
+	latest *oauth2.Token
+
+	references int
+	keepUntil  time.Time
+}
+
+// tokenRefresher coordinates token refreshes across concurrent requests. All
+// requests presenting the same refresh token share one refreshEntry, so only
+// the first of them contacts the token endpoint and the others reuse its
+// result even when their session still holds the stale token.
+//
+// Entries are reference counted: an entry stays in the map while a request
+// holds it and afterwards only until its remembered token expires, so a
+// request can never end up with an entry that another request replaced.
+type tokenRefresher struct {
+	mutex   sync.Mutex
+	entries map[string]*refreshEntry
+	sweptAt time.Time
+}
+
+func newTokenRefresher() *tokenRefresher {
+	return &tokenRefresher{entries: make(map[string]*refreshEntry), sweptAt: time.Now()}
+}
+
+// acquire returns the refreshEntry for refreshToken and holds a reference to
+// it until release is called. At most once per refreshEntrySweepInterval it
+// also drops unreferenced entries whose remembered token has expired.
+func (refresherInstance *tokenRefresher) acquire(refreshToken string) *refreshEntry {
+	refresherInstance.mutex.Lock()
+	defer refresherInstance.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(refresherInstance.sweptAt) >= refreshEntrySweepInterval {
+		for key, staleEntry := range refresherInstance.entries {
+			if staleEntry.references == 0 && !now.Before(staleEntry.keepUntil) {
+				delete(refresherInstance.entries, key)
+			}
+		}
+		refresherInstance.sweptAt = now
+	}
+
+	existingEntry, found := refresherInstance.entries[refreshToken]
+	if !found {
+		existingEntry = &refreshEntry{}
+		refresherInstance.entries[refreshToken] = existingEntry
+	}
+	existingEntry.references++
+	return existingEntry
+}
+
+// release drops a reference taken by acquire. keepUntil is the expiry of the
+// token the holder left in the entry; the entry is removed once it is
+// unreferenced and no remembered token is left to share.
+func (refresherInstance *tokenRefresher) release(refreshToken string, entry *refreshEntry, keepUntil time.Time) {
+	refresherInstance.mutex.Lock()
+	defer refresherInstance.mutex.Unlock()
+
+	entry.references--
+	if keepUntil.After(entry.keepUntil) {
+		entry.keepUntil = keepUntil
+	}
+	if entry.references == 0 && !time.Now().Before(entry.keepUntil) {
+		delete(refresherInstance.entries, refreshToken)
+	}
+}
+
+// sessionTokenSource is an oauth2.TokenSource bound to one request. When the
+// session's token has expired it refreshes it and writes the new token back
+// into the session.
+type sessionTokenSource struct {
+	handlers       *Handlers
+	responseWriter http.ResponseWriter
+	request        *http.Request
+
+	mutex   sync.Mutex
+	current *oauth2.Token
+}
+
+// Token returns a valid access token, refreshing and persisting it if needed.
+func (tokenSource *sessionTokenSource) Token() (*oauth2.Token, error) {
+	tokenSource.mutex.Lock()
+	defer tokenSource.mutex.Unlock()
+
+	if tokenSource.current.Valid() {
+		return tokenSource.current, nil
+	}
+	if tokenSource.current.RefreshToken == "" {
+		return nil, errors.New("oauth token expired and no refresh token is available")
+	}
+
+	serviceInstance := tokenSource.handlers.service
+	refreshToken := tokenSource.current.RefreshToken
+	entry := serviceInstance.refresher.acquire(refreshToken)
+	var keepUntil time.Time
+	defer func() { serviceInstance.refresher.release(refreshToken, entry, keepUntil) }()
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	refreshedToken := entry.latest
+	if !refreshedToken.Valid() {
+		newToken, refreshError := serviceInstance.oauthConfig().TokenSource(serviceInstance.providerContext(tokenSource.request.Context()), tokenSource.current).Token()
+		if refreshError != nil {
+			return nil, fmt.Errorf("failed to refresh oauth token: %w", refreshError)
+		}
+		entry.latest = newToken
+		refreshedToken = newToken
+	}
+	keepUntil = refreshedToken.Expiry
+
+	if persistError := tokenSource.persist(refreshedToken); persistError != nil {
+		serviceInstance.logger.Error("Failed to persist refreshed token", "error", persistError)
+	}
+	tokenSource.current = refreshedToken
+	return refreshedToken, nil
+}
+
+// persist stores refreshedToken in the request's session.
+func (tokenSource *sessionTokenSource) persist(refreshedToken *oauth2.Token) error {
+	webSession, _ := tokenSource.handlers.store.Get(tokenSource.request, constants.SessionName)
+	if storeError := storeTokenInSession(webSession, refreshedToken); storeError != nil {
+		return storeError
+	}
+	return webSession.Save(tokenSource.request, tokenSource.responseWriter)
+}
+
+// TokenSource returns an oauth2.TokenSource for the user of the current
+// request, failing with the errors documented for TokenFromRequest. Whenever
+// the stored access token has expired, the source refreshes it and writes the
+// new token back into the session, so later requests do not refresh again.
+// Concurrent requests of the same user share a single refresh.
+//
+// A token that has already expired is refreshed immediately, so that cookie
+// based stores can still set the updated cookie; obtain the source before the
+// handler starts writing its response.
+func (handlersInstance *Handlers) TokenSource(responseWriter http.ResponseWriter, request *http.Request) (oauth2.TokenSource, error) {
+	storedToken, tokenError := handlersInstance.Token(request)
+	if tokenError != nil {
+		return nil, tokenError
+	}
+
+	webSession, _ := handlersInstance.store.Get(request, constants.SessionName)
+	tokenSource := &sessionTokenSource{
+		handlers:       handlersInstance.forSession(webSession),
+		responseWriter: responseWriter,
+		request:        request,
+		current:        storedToken,
+	}
+	if !storedToken.Valid() {
+		if _, refreshError := tokenSource.Token(); refreshError != nil {
+			return nil, refreshError
+		}
+	}
+	return tokenSource, nil
+}
+
+// Client returns an *http.Client authorized with the current request's token.
+// Refreshed tokens are written back to the session as described for
+// TokenSource.
+func (handlersInstance *Handlers) Client(responseWriter http.ResponseWriter, request *http.Request) (*http.Client, error) {
+	tokenSource, sourceError := handlersInstance.TokenSource(responseWriter, request)
+	if sourceError != nil {
+		return nil, sourceError
+	}
+	return oauth2.NewClient(request.Context(), tokenSource), nil
+}
@@ -0,0 +1,161 @@
+package gauss
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/temirov/GAuss/pkg/constants"
+	"golang.org/x/oauth2"
+)
+
+func TestClientRefreshesAndPersistsToken(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	h := newProviderHandlers(t, provider)
+	expired := &oauth2.Token{AccessToken: "stale-token", RefreshToken: "rtok", TokenType: "Bearer", Expiry: time.Now().Add(-time.Hour)}
+	cookie := sessionCookieWithToken(t, h, expired)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh-token" {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+	}))
+	defer api.Close()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	client, err := h.Client(rr, req)
+	if err != nil {
+		t.Fatalf("Client error: %v", err)
+	}
+	if _, err := client.Get(api.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// The refreshed token must have been written back to the session.
+	chkReq := httptest.NewRequest("GET", "/", nil)
+	chkReq.AddCookie(rr.Result().Cookies()[0])
+	sess, _ := h.store.Get(chkReq, constants.SessionName)
+	var stored oauth2.Token
+	json.Unmarshal([]byte(sess.Values[constants.SessionKeyOAuthToken].(string)), &stored)
+	if stored.AccessToken != "fresh-token" || stored.RefreshToken != "rtok" {
+		t.Fatalf("refreshed token not persisted: %+v", stored)
+	}
+
+	// A request with the updated cookie does not refresh again.
+	nextReq := httptest.NewRequest("GET", "/", nil)
+	nextReq.AddCookie(rr.Result().Cookies()[0])
+	source, err := h.TokenSource(httptest.NewRecorder(), nextReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok, _ := source.Token(); tok.AccessToken != "fresh-token" {
+		t.Fatalf("unexpected token %q", tok.AccessToken)
+	}
+	if got := provider.refreshes.Load(); got != 1 {
+		t.Fatalf("expected one refresh, got %d", got)
+	}
+}
+
+func TestTokenSourceConcurrentRefresh(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	h := newProviderHandlers(t, provider)
+	expired := &oauth2.Token{AccessToken: "stale-token", RefreshToken: "rtok", TokenType: "Bearer", Expiry: time.Now().Add(-time.Hour)}
+	cookie := sessionCookieWithToken(t, h, expired)
+
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			req := httptest.NewRequest("GET", "/", nil)
+			req.AddCookie(cookie)
+			source, err := h.TokenSource(httptest.NewRecorder(), req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if tok, err := source.Token(); err != nil || tok.AccessToken != "fresh-token" {
+				t.Errorf("unexpected token %v, %v", tok, err)
+			}
+		}()
+	}
+	waitGroup.Wait()
+	if got := provider.refreshes.Load(); got != 1 {
+		t.Fatalf("expected a single shared refresh, got %d", got)
+	}
+}
+
+func TestTokenSourceMissingToken(t *testing.T) {
+	provider := newFakeProvider(t, nil)
+	h := newProviderHandlers(t, provider)
+	if _, err := h.TokenSource(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)); !errors.Is(err, ErrNotAuthenticated) {
+		t.Fatalf("expected ErrNotAuthenticated, got %v", err)
+	}
+}
+
+func TestTokenRefresherEvictsStaleEntries(t *testing.T) {
+	refresher := newTokenRefresher()
+	release := func(key string, keepUntil time.Time) {
+		refresher.release(key, refresher.acquire(key), keepUntil)
+	}
+	release("failed", time.Time{})
+	release("expiring", time.Now().Add(time.Hour))
+	release("valid", time.Now().Add(2*time.Hour))
+	held := refresher.acquire("held")
+	if _, found := refresher.entries["failed"]; found {
+		t.Error("expected an entry without a token to be dropped on release")
+	}
+
+	refresher.entries["expiring"].keepUntil = time.Now().Add(-time.Second)
+	refresher.sweptAt = time.Now().Add(-refreshEntrySweepInterval)
+	refresher.acquire("new")
+	if _, found := refresher.entries["expiring"]; found {
+		t.Error("expected the expired entry to be swept")
+	}
+	for _, key := range []string{"valid", "held", "new"} {
+		if _, found := refresher.entries[key]; !found {
+			t.Errorf("expected entry %q to be kept", key)
+		}
+	}
+	if refresher.acquire("held") != held {
+		t.Fatal("expected a held entry to be shared")
+	}
+}
+
+func TestTokenRefresherSerializesHolders(t *testing.T) {
+	refresher := newTokenRefresher()
+	var holders atomic.Int32
+	var overlapped atomic.Bool
+	var waitGroup sync.WaitGroup
+	for range 16 {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for range 200 {
+				entry := refresher.acquire("rtok")
+				entry.mutex.Lock()
+				if holders.Add(1) > 1 {
+					overlapped.Store(true)
+				}
+				holders.Add(-1)
+				entry.mutex.Unlock()
+				// Releasing without a token drops the entry whenever it is unreferenced.
+				refresher.release("rtok", entry, time.Time{})
+			}
+		}()
+	}
+	waitGroup.Wait()
+	if overlapped.Load() {
+		t.Fatal("expected holders of one refresh token's entry to be serialized")
+	}
+	if len(refresher.entries) != 0 {
+		t.Fatalf("expected unreferenced entries to be dropped, got %d", len(refresher.entries))
+	}
+}
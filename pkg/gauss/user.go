@@ -0,0 +1,56 @@
+package gauss
+
+import (
+	"github.com/gorilla/sessions"
+	"github.com/temirov/GAuss/pkg/constants"
+)
+
+// apiUserPlaceholder marks sessions created with API-only scopes, where no
+// profile is available but the middleware still needs a non-nil user key.
+const apiUserPlaceholder = "authenticated_api_user"
+
+// storeUserInSession writes every profile field of googleUser into the
+// session under the constants.SessionKeyUser* keys.
+func storeUserInSession(webSession *sessions.Session, googleUser *GoogleUser) {
+	webSession.Values[constants.SessionKeyUserSubject] = googleUser.Subject
+	webSession.Values[constants.SessionKeyUserEmail] = googleUser.Email
+	webSession.Values[constants.SessionKeyUserEmailVerified] = googleUser.EmailVerified
+	webSession.Values[constants.SessionKeyUserName] = googleUser.Name
+	webSession.Values[constants.SessionKeyUserGivenName] = googleUser.GivenName
+	webSession.Values[constants.SessionKeyUserFamilyName] = googleUser.FamilyName
+	webSession.Values[constants.SessionKeyUserPicture] = googleUser.Picture
+	webSession.Values[constants.SessionKeyUserLocale] = googleUser.Locale
+	webSession.Values[constants.SessionKeyUserHostedDomain] = googleUser.HostedDomain
+}
+
+// UserFromSession returns the user stored in a GAuss session. The boolean is
+// false when the session does not belong to a logged-in user. Sessions created
+// with API-only scopes yield an empty GoogleUser, and sessions created before
+// the subject was recorded yield an empty Subject.
+func UserFromSession(webSession *sessions.Session) (*GoogleUser, bool) {
+	if webSession == nil || webSession.Values[constants.SessionKeyUserEmail] == nil {
+		return nil, false
+	}
+
+	stringValue := func(key string) string {
+		value, _ := webSession.Values[key].(string)
+		return value
+	}
+	emailVerified, _ := webSession.Values[constants.SessionKeyUserEmailVerified].(bool)
+
+	googleUser := &GoogleUser{
+		Subject:       stringValue(constants.SessionKeyUserSubject),
+		Email:         stringValue(constants.SessionKeyUserEmail),
+		EmailVerified: emailVerified,
+		Name:          stringValue(constants.SessionKeyUserName),
+		GivenName:     stringValue(constants.SessionKeyUserGivenName),
+		FamilyName:    stringValue(constants.SessionKeyUserFamilyName),
+		Picture:       stringValue(constants.SessionKeyUserPicture),
+		Locale:        stringValue(constants.SessionKeyUserLocale),
+		HostedDomain:  stringValue(constants.SessionKeyUserHostedDomain),
+	}
+	if googleUser.Email == apiUserPlaceholder {
+		googleUser.Email = ""
+	}
+	return googleUser, true
+}
@@ -0,0 +1,61 @@
+package gauss
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/temirov/GAuss/pkg/constants"
+	"github.com/temirov/GAuss/pkg/session"
+)
+
+func TestUserFromSessionRoundTrip(t *testing.T) {
+	session.NewSession([]byte("secret"))
+	want := GoogleUser{
+		Subject:       "1234567890",
+		Email:         "e@example.com",
+		EmailVerified: true,
+		Name:          "Test User",
+		GivenName:     "Test",
+		FamilyName:    "User",
+		Picture:       "pic",
+		Locale:        "en",
+		HostedDomain:  "example.com",
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	sess, _ := session.Store().Get(req, constants.SessionName)
+	storeUserInSession(sess, &want)
+	if err := sess.Save(req, rr); err != nil {
+		t.Fatal(err)
+	}
+
+	chkReq := httptest.NewRequest("GET", "/", nil)
+	chkReq.AddCookie(rr.Result().Cookies()[0])
+	sess2, _ := session.Store().Get(chkReq, constants.SessionName)
+	got, ok := UserFromSession(sess2)
+	if !ok {
+		t.Fatal("expected a logged-in user")
+	}
+	if *got != want {
+		t.Fatalf("unexpected user: %+v", got)
+	}
+}
+
+func TestUserFromSessionAnonymousAndAPIOnly(t *testing.T) {
+	anonymous := sessions.NewSession(&sessions.CookieStore{}, constants.SessionName)
+	if _, ok := UserFromSession(anonymous); ok {
+		t.Fatal("anonymous session should not yield a user")
+	}
+
+	apiOnly := sessions.NewSession(&sessions.CookieStore{}, constants.SessionName)
+	apiOnly.Values[constants.SessionKeyUserEmail] = apiUserPlaceholder
+	user, ok := UserFromSession(apiOnly)
+	if !ok {
+		t.Fatal("API-only session should be authenticated")
+	}
+	if user.Email != "" || user.Subject != "" {
+		t.Fatalf("expected empty profile, got %+v", user)
+	}
+}
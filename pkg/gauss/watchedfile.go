@@ -0,0 +1,117 @@
+package gauss
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// watchedFileCheckInterval rate limits how often a watchedFile looks for
+// changes.
+const watchedFileCheckInterval = 2 * time.Second
+
+// watchedFile reloads a configuration file through its parse function whenever
+// the file's modification time or size changes. Reload failures keep the
+// previously parsed content and are logged once per distinct error.
+type watchedFile struct {
+	path          string
+	checkInterval time.Duration
+	parse         func(*os.File) error
+
+	mutex       sync.Mutex
+	logger      *slog.Logger
+	modTime     time.Time
+	size        int64
+	checkedAt   time.Time
+	reloadError string
+}
+
+// reloadLogger is implemented by the file backed policies and role resolvers,
+// so that New can point their reload failures at the Service's logger.
+type reloadLogger interface {
+	setReloadLogger(logger *slog.Logger)
+}
+
+// setLogger sets the logger reload failures are reported to.
+func (file *watchedFile) setLogger(logger *slog.Logger) {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	file.logger = logger
+}
+
+// newWatchedFile creates a watchedFile and performs the initial load.
+func newWatchedFile(path string, parse func(*os.File) error) (*watchedFile, error) {
+	file := &watchedFile{path: path, checkInterval: watchedFileCheckInterval, parse: parse}
+	if reloadError := file.reload(); reloadError != nil {
+		return nil, reloadError
+	}
+	return file, nil
+}
+
+// reload reads the file unconditionally.
+func (file *watchedFile) reload() error {
+	fileInfo, statError := os.Stat(file.path)
+	if statError != nil {
+		return fmt.Errorf("failed to stat %s: %w", file.path, statError)
+	}
+	openedFile, openError := os.Open(file.path)
+	if openError != nil {
+		return fmt.Errorf("failed to open %s: %w", file.path, openError)
+	}
+	defer openedFile.Close()
+	if parseError := file.parse(openedFile); parseError != nil {
+		return fmt.Errorf("failed to read %s: %w", file.path, parseError)
+	}
+
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	file.modTime = fileInfo.ModTime()
+	file.size = fileInfo.Size()
+	file.checkedAt = time.Now()
+	return nil
+}
+
+// reloadIfChanged reloads the file when it changed since the last load,
+// checking at most once per checkInterval.
+func (file *watchedFile) reloadIfChanged() {
+	file.mutex.Lock()
+	if time.Since(file.checkedAt) < file.checkInterval {
+		file.mutex.Unlock()
+		return
+	}
+	file.checkedAt = time.Now()
+	loadedModTime, loadedSize := file.modTime, file.size
+	file.mutex.Unlock()
+
+	fileInfo, statError := os.Stat(file.path)
+	if statError == nil && fileInfo.ModTime().Equal(loadedModTime) && fileInfo.Size() == loadedSize {
+		return
+	}
+	reloadError := statError
+	if reloadError == nil {
+		reloadError = file.reload()
+	}
+	file.reportReloadError(reloadError)
+}
+
+// reportReloadError logs reloadError unless the previous reload failed the
+// same way; a nil reloadError resets the reporting.
+func (file *watchedFile) reportReloadError(reloadError error) {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+	if reloadError == nil {
+		file.reloadError = ""
+		return
+	}
+	if reloadError.Error() == file.reloadError {
+		return
+	}
+	file.reloadError = reloadError.Error()
+	logger := file.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Warn("Failed to reload file; keeping its previous content", "event", "file_reload_failed", "path", file.path, "error", reloadError)
+}
@@ -0,0 +1,32 @@
+// Package gausstest provides an in-process fake of Google's OAuth 2.0 and
+// OpenID Connect endpoints for end-to-end tests of applications built on
+// gauss.
+//
+// NewServer starts the fake authorization server. It implements the
+// authorization, token, userinfo, JWKS, revocation and tokeninfo endpoints,
+// signs ID tokens with its own key and checks PKCE, client credentials and
+// redirect URIs like Google does. Pass Server.Option to gauss.New together
+// with the server's ClientID and ClientSecret, and the Service talks to the
+// fake instead of Google:
+//
+//	provider := gausstest.NewServer(t, gausstest.WithUser(gauss.GoogleUser{
+//		Subject: "1", Email: "alice@example.com", EmailVerified: true,
+//	}))
+//	svc, err := gauss.New(provider.ClientID, provider.ClientSecret,
+//		gauss.WithBaseURL(app.URL),
+//		provider.Option(),
+//	)
+//
+// The authorization endpoint approves every request immediately for the user
+// chosen with SignInAs, the login_hint parameter or, by default, the first
+// user, so an http.Client with a cookie jar that follows redirects completes
+// the whole login. Errors and refresh behavior are scripted with
+// FailNextAuthorization, FailNextTokenRequest and WithRefreshTokens.
+//
+// The server also publishes an OpenID Connect discovery document, so it can
+// stand in for a generic provider created with gauss.DiscoverOIDCProvider.
+//
+// Tests that only need a logged-in user skip the provider: LoginAs,
+// NewAuthenticatedRequest and NewAuthenticatedClient create a session directly
+// in the session store of a gauss.Handlers.
+package gausstest
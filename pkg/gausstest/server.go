@@ -0,0 +1,608 @@
+package gausstest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/temirov/GAuss/pkg/gauss"
+)
+
+const (
+	// DefaultClientID is the client ID a Server accepts unless WithClient
+	// overrides it.
+	DefaultClientID = "gausstest-client.apps.googleusercontent.com"
+	// DefaultClientSecret is the client secret a Server accepts unless
+	// WithClient overrides it.
+	DefaultClientSecret = "gausstest-secret"
+	// defaultAccessTokenLifetime is the lifetime of issued access tokens.
+	defaultAccessTokenLifetime = time.Hour
+)
+
+// Paths of the fake endpoints below Server.URL.
+const (
+	AuthorizePath = "/authorize"
+	TokenPath     = "/token"
+	UserInfoPath  = "/userinfo"
+	JWKSPath      = "/jwks"
+	RevokePath    = "/revoke"
+	TokenInfoPath = "/tokeninfo"
+	DiscoveryPath = "/.well-known/openid-configuration"
+)
+
+// RefreshTokenMode decides when the token endpoint returns a refresh token.
+type RefreshTokenMode int
+
+const (
+	// RefreshTokensOffline returns a refresh token whenever access_type=offline
+	// was requested. It is the default.
+	RefreshTokensOffline RefreshTokenMode = iota
+	// RefreshTokensOnConsent returns a refresh token only when offline access
+	// was requested with prompt=consent, like Google does for users who have
+	// already granted offline access.
+	RefreshTokensOnConsent
+	// RefreshTokensNever never returns a refresh token.
+	RefreshTokensNever
+)
+
+// authorization is an approved authorization request waiting for its code to
+// be exchanged.
+type authorization struct {
+	user              gauss.GoogleUser
+	redirectURI       string
+	codeChallenge     string
+	nonce             string
+	scopes            []string
+	issueRefreshToken bool
+}
+
+// grant is an issued access or refresh token.
+type grant struct {
+	user         gauss.GoogleUser
+	scopes       []string
+	expiresAt    time.Time
+	refreshToken string
+}
+
+// Server is a fake Google authorization server running on a local HTTP
+// listener. It is safe for concurrent use.
+type Server struct {
+	// URL is the base URL of the server, e.g. "http://127.0.0.1:1234".
+	URL string
+	// ClientID and ClientSecret are the credentials the server accepts.
+	ClientID     string
+	ClientSecret string
+
+	testingT            testing.TB
+	httpServer          *httptest.Server
+	signingKey          *rsa.PrivateKey
+	keyID               string
+	accessTokenLifetime time.Duration
+	refreshTokenMode    RefreshTokenMode
+
+	mutex               sync.Mutex
+	users               []gauss.GoogleUser
+	signedInEmail       string
+	authorizations      map[string]*authorization
+	accessTokens        map[string]*grant
+	refreshTokens       map[string]*grant
+	revokedTokens       map[string]bool
+	authorizationErrors []string
+	tokenErrors         []string
+	refreshCount        int
+}
+
+// ServerOption configures a Server created with NewServer.
+type ServerOption func(*Server)
+
+// WithUser adds a user who can sign in. The first user added signs in unless
+// SignInAs or a login_hint chooses another one.
+func WithUser(user gauss.GoogleUser) ServerOption {
+	return func(server *Server) {
+		server.users = append(server.users, user)
+	}
+}
+
+// WithClient sets the client credentials the server accepts.
+func WithClient(clientID string, clientSecret string) ServerOption {
+	return func(server *Server) {
+		server.ClientID = clientID
+		server.ClientSecret = clientSecret
+	}
+}
+
+// WithAccessTokenLifetime sets the lifetime of issued access tokens. Lifetimes
+// below ten seconds make golang.org/x/oauth2 treat tokens as expired at once,
+// which exercises refreshes.
+func WithAccessTokenLifetime(lifetime time.Duration) ServerOption {
+	return func(server *Server) {
+		server.accessTokenLifetime = lifetime
+	}
+}
+
+// WithRefreshTokens sets when the token endpoint returns refresh tokens.
+func WithRefreshTokens(mode RefreshTokenMode) ServerOption {
+	return func(server *Server) {
+		server.refreshTokenMode = mode
+	}
+}
+
+// NewServer starts a Server that is closed when the test finishes.
+func NewServer(t testing.TB, options ...ServerOption) *Server {
+	t.Helper()
+	signingKey, keyError := rsa.GenerateKey(rand.Reader, 2048)
+	if keyError != nil {
+		t.Fatalf("gausstest: failed to generate signing key: %v", keyError)
+	}
+	server := &Server{
+		ClientID:            DefaultClientID,
+		ClientSecret:        DefaultClientSecret,
+		testingT:            t,
+		signingKey:          signingKey,
+		keyID:               randomValue("key-"),
+		accessTokenLifetime: defaultAccessTokenLifetime,
+		authorizations:      make(map[string]*authorization),
+		accessTokens:        make(map[string]*grant),
+		refreshTokens:       make(map[string]*grant),
+		revokedTokens:       make(map[string]bool),
+	}
+	for _, option := range options {
+		option(server)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(AuthorizePath, server.authorize)
+	mux.HandleFunc(TokenPath, server.token)
+	mux.HandleFunc(UserInfoPath, server.userInfo)
+	mux.HandleFunc(JWKSPath, server.keys)
+	mux.HandleFunc(RevokePath, server.revoke)
+	mux.HandleFunc(TokenInfoPath, server.tokenInfo)
+	mux.HandleFunc(DiscoveryPath, server.discovery)
+	server.httpServer = httptest.NewServer(mux)
+	server.URL = server.httpServer.URL
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Close shuts the server down.
+func (server *Server) Close() {
+	server.httpServer.Close()
+}
+
+// Endpoints returns the URLs of the fake endpoints.
+func (server *Server) Endpoints() gauss.Endpoints {
+	return gauss.Endpoints{
+		AuthURL:       server.URL + AuthorizePath,
+		TokenURL:      server.URL + TokenPath,
+		UserInfoURL:   server.URL + UserInfoPath,
+		JWKSURL:       server.URL + JWKSPath,
+		RevocationURL: server.URL + RevokePath,
+		TokenInfoURL:  server.URL + TokenInfoPath,
+		Issuer:        server.URL,
+	}
+}
+
+// Option points a gauss.Service at the server. Create the Service with the
+// server's ClientID and ClientSecret.
+func (server *Server) Option() gauss.Option {
+	return gauss.WithEndpoints(server.Endpoints())
+}
+
+// AddUser adds a user who can sign in.
+func (server *Server) AddUser(user gauss.GoogleUser) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.users = append(server.users, user)
+}
+
+// SignInAs makes the user with email sign in at the authorization endpoint
+// until SignInAs is called again. A login_hint still takes precedence.
+func (server *Server) SignInAs(email string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.signedInEmail = email
+}
+
+// FailNextAuthorization makes the next authorization request redirect back
+// with the given error, e.g. "access_denied" or "login_required".
+func (server *Server) FailNextAuthorization(errorCode string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.authorizationErrors = append(server.authorizationErrors, errorCode)
+}
+
+// FailNextTokenRequest makes the next code exchange or refresh fail with
+// status 400 and the given error, e.g. "invalid_grant".
+func (server *Server) FailNextTokenRequest(errorCode string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.tokenErrors = append(server.tokenErrors, errorCode)
+}
+
+// IssueAccessToken returns a valid access token for the user with email, as a
+// mobile or CLI client would hold it.
+func (server *Server) IssueAccessToken(email string) string {
+	server.testingT.Helper()
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	user := server.mustFindUser(email)
+	return server.issueAccessToken(user, []string{"openid", "email", "profile"}, "")
+}
+
+// IssueIDToken returns a signed ID token for the user with email, issued to
+// the server's ClientID.
+func (server *Server) IssueIDToken(email string) string {
+	server.testingT.Helper()
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.signIDToken(server.mustFindUser(email), "")
+}
+
+// Revoked reports whether token has been revoked at the revocation endpoint.
+func (server *Server) Revoked(token string) bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.revokedTokens[token]
+}
+
+// RefreshCount returns how many refresh token grants succeeded.
+func (server *Server) RefreshCount() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.refreshCount
+}
+
+// mustFindUser returns the user with email or fails the test. The caller must
+// hold the mutex.
+func (server *Server) mustFindUser(email string) gauss.GoogleUser {
+	server.testingT.Helper()
+	for _, user := range server.users {
+		if strings.EqualFold(user.Email, email) {
+			return user
+		}
+	}
+	server.testingT.Fatalf("gausstest: no user with email %q", email)
+	return gauss.GoogleUser{}
+}
+
+// signingInUser picks the user approving an authorization request. The
+// caller must hold the mutex.
+func (server *Server) signingInUser(loginHint string) (gauss.GoogleUser, bool) {
+	for _, email := range []string{loginHint, server.signedInEmail} {
+		if email == "" {
+			continue
+		}
+		for _, user := range server.users {
+			if strings.EqualFold(user.Email, email) {
+				return user, true
+			}
+		}
+	}
+	if len(server.users) == 0 {
+		return gauss.GoogleUser{}, false
+	}
+	return server.users[0], true
+}
+
+// authorize approves the request at once and redirects back with a code, or
+// with an error scripted by FailNextAuthorization.
+func (server *Server) authorize(responseWriter http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	if query.Get("client_id") != server.ClientID {
+		http.Error(responseWriter, "invalid_client", http.StatusBadRequest)
+		return
+	}
+	redirectURI, parseError := url.Parse(query.Get("redirect_uri"))
+	if parseError != nil || !redirectURI.IsAbs() {
+		http.Error(responseWriter, "redirect_uri_mismatch", http.StatusBadRequest)
+		return
+	}
+	redirectWith := func(values url.Values) {
+		values.Set("state", query.Get("state"))
+		redirectURI.RawQuery = values.Encode()
+		http.Redirect(responseWriter, request, redirectURI.String(), http.StatusFound)
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if len(server.authorizationErrors) > 0 {
+		errorCode := server.authorizationErrors[0]
+		server.authorizationErrors = server.authorizationErrors[1:]
+		redirectWith(url.Values{"error": {errorCode}})
+		return
+	}
+	if query.Get("response_type") != "code" {
+		redirectWith(url.Values{"error": {"unsupported_response_type"}})
+		return
+	}
+	if query.Get("code_challenge") != "" && query.Get("code_challenge_method") != "S256" {
+		redirectWith(url.Values{"error": {"invalid_request"}})
+		return
+	}
+	user, found := server.signingInUser(query.Get("login_hint"))
+	if !found {
+		redirectWith(url.Values{"error": {"access_denied"}})
+		return
+	}
+
+	offline := query.Get("access_type") == "offline"
+	consent := slices.Contains(strings.Fields(query.Get("prompt")), "consent")
+	code := randomValue("code-")
+	server.authorizations[code] = &authorization{
+		user:          user,
+		redirectURI:   redirectURI.String(),
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+		scopes:        strings.Fields(query.Get("scope")),
+		issueRefreshToken: offline && (server.refreshTokenMode == RefreshTokensOffline ||
+			server.refreshTokenMode == RefreshTokensOnConsent && consent),
+	}
+	redirectWith(url.Values{"code": {code}})
+}
+
+// token implements the authorization_code and refresh_token grants.
+func (server *Server) token(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost || request.ParseForm() != nil {
+		writeJSON(responseWriter, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, clientSecret, basicAuth := request.BasicAuth()
+	if basicAuth {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = request.PostForm.Get("client_id"), request.PostForm.Get("client_secret")
+	}
+	if clientID != server.ClientID || clientSecret != server.ClientSecret {
+		writeJSON(responseWriter, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if len(server.tokenErrors) > 0 {
+		errorCode := server.tokenErrors[0]
+		server.tokenErrors = server.tokenErrors[1:]
+		writeJSON(responseWriter, http.StatusBadRequest, map[string]string{"error": errorCode})
+		return
+	}
+
+	switch request.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code := request.PostForm.Get("code")
+		approved, found := server.authorizations[code]
+		delete(server.authorizations, code)
+		if !found || approved.redirectURI != request.PostForm.Get("redirect_uri") {
+			writeJSON(responseWriter, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		if approved.codeChallenge != "" {
+			verifierDigest := sha256.Sum256([]byte(request.PostForm.Get("code_verifier")))
+			if base64.RawURLEncoding.EncodeToString(verifierDigest[:]) != approved.codeChallenge {
+				writeJSON(responseWriter, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "Invalid code verifier."})
+				return
+			}
+		}
+		refreshToken := ""
+		if approved.issueRefreshToken {
+			refreshToken = randomValue("1//")
+			server.refreshTokens[refreshToken] = &grant{user: approved.user, scopes: approved.scopes}
+		}
+		server.writeTokenResponse(responseWriter, approved.user, approved.scopes, refreshToken, true, approved.nonce)
+	case "refresh_token":
+		refreshToken := request.PostForm.Get("refresh_token")
+		refreshGrant, found := server.refreshTokens[refreshToken]
+		if !found || server.revokedTokens[refreshToken] {
+			writeJSON(responseWriter, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "Token has been expired or revoked."})
+			return
+		}
+		server.refreshCount++
+		server.writeTokenResponse(responseWriter, refreshGrant.user, refreshGrant.scopes, refreshToken, false, "")
+	default:
+		writeJSON(responseWriter, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+	}
+}
+
+// writeTokenResponse issues an access token tied to refreshToken, which may be
+// empty, and, for the openid scope, an ID token. Like Google, only code
+// exchanges return the refresh token. The caller must hold the mutex.
+func (server *Server) writeTokenResponse(responseWriter http.ResponseWriter, user gauss.GoogleUser, scopes []string, refreshToken string, returnRefreshToken bool, nonce string) {
+	response := map[string]interface{}{
+		"access_token": server.issueAccessToken(user, scopes, refreshToken),
+		"token_type":   "Bearer",
+		"expires_in":   int(server.accessTokenLifetime.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	}
+	if refreshToken != "" && returnRefreshToken {
+		response["refresh_token"] = refreshToken
+	}
+	if slices.Contains(scopes, "openid") {
+		response["id_token"] = server.signIDToken(user, nonce)
+	}
+	writeJSON(responseWriter, http.StatusOK, response)
+}
+
+// issueAccessToken records and returns a new access token. The caller must
+// hold the mutex.
+func (server *Server) issueAccessToken(user gauss.GoogleUser, scopes []string, refreshToken string) string {
+	accessToken := randomValue("ya29.")
+	server.accessTokens[accessToken] = &grant{
+		user:         user,
+		scopes:       scopes,
+		expiresAt:    time.Now().Add(server.accessTokenLifetime),
+		refreshToken: refreshToken,
+	}
+	return accessToken
+}
+
+// validAccessToken returns the grant of an unexpired, unrevoked access token.
+// The caller must hold the mutex.
+func (server *Server) validAccessToken(accessToken string) (*grant, bool) {
+	accessGrant, found := server.accessTokens[accessToken]
+	if !found || server.revokedTokens[accessToken] || time.Now().After(accessGrant.expiresAt) {
+		return nil, false
+	}
+	return accessGrant, true
+}
+
+// signIDToken returns an RS256 ID token for user. The caller must hold the
+// mutex.
+func (server *Server) signIDToken(user gauss.GoogleUser, nonce string) string {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":            server.URL,
+		"aud":            server.ClientID,
+		"azp":            server.ClientID,
+		"sub":            user.Subject,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"name":           user.Name,
+		"given_name":     user.GivenName,
+		"family_name":    user.FamilyName,
+		"picture":        user.Picture,
+		"locale":         user.Locale,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+	if user.HostedDomain != "" {
+		claims["hd"] = user.HostedDomain
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	headerJSON, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": server.keyID, "typ": "JWT"})
+	claimsJSON, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, signError := rsa.SignPKCS1v15(rand.Reader, server.signingKey, crypto.SHA256, digest[:])
+	if signError != nil {
+		panic("gausstest: failed to sign id token: " + signError.Error())
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// userInfo returns the profile of the access token's user.
+func (server *Server) userInfo(responseWriter http.ResponseWriter, request *http.Request) {
+	accessToken := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+	server.mutex.Lock()
+	accessGrant, valid := server.validAccessToken(accessToken)
+	server.mutex.Unlock()
+	if !valid {
+		writeJSON(responseWriter, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+	writeJSON(responseWriter, http.StatusOK, accessGrant.user)
+}
+
+// keys publishes the public signing key.
+func (server *Server) keys(responseWriter http.ResponseWriter, request *http.Request) {
+	publicKey := server.signingKey.PublicKey
+	writeJSON(responseWriter, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": server.keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	})
+}
+
+// revoke revokes an access token, or a refresh token together with the access
+// tokens issued with it.
+func (server *Server) revoke(responseWriter http.ResponseWriter, request *http.Request) {
+	revokedToken := request.FormValue("token")
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	_, isAccessToken := server.accessTokens[revokedToken]
+	_, isRefreshToken := server.refreshTokens[revokedToken]
+	if !isAccessToken && !isRefreshToken {
+		writeJSON(responseWriter, http.StatusBadRequest, map[string]string{"error": "invalid_token"})
+		return
+	}
+	server.revokedTokens[revokedToken] = true
+	if isRefreshToken {
+		for accessToken, accessGrant := range server.accessTokens {
+			if accessGrant.refreshToken == revokedToken {
+				server.revokedTokens[accessToken] = true
+			}
+		}
+	}
+	writeJSON(responseWriter, http.StatusOK, map[string]string{})
+}
+
+// tokenInfo describes an access token the way Google's tokeninfo endpoint
+// does, with numbers and booleans encoded as strings.
+func (server *Server) tokenInfo(responseWriter http.ResponseWriter, request *http.Request) {
+	accessToken := request.FormValue("access_token")
+	server.mutex.Lock()
+	accessGrant, valid := server.validAccessToken(accessToken)
+	server.mutex.Unlock()
+	if !valid {
+		writeJSON(responseWriter, http.StatusBadRequest, map[string]string{"error": "invalid_token", "error_description": "Invalid Value"})
+		return
+	}
+	writeJSON(responseWriter, http.StatusOK, map[string]string{
+		"azp":            server.ClientID,
+		"aud":            server.ClientID,
+		"sub":            accessGrant.user.Subject,
+		"scope":          strings.Join(accessGrant.scopes, " "),
+		"exp":            strconv.FormatInt(accessGrant.expiresAt.Unix(), 10),
+		"expires_in":     strconv.Itoa(int(time.Until(accessGrant.expiresAt).Seconds())),
+		"email":          accessGrant.user.Email,
+		"email_verified": strconv.FormatBool(accessGrant.user.EmailVerified),
+	})
+}
+
+// discovery publishes the OpenID Connect discovery document, so the server
+// can also stand in for a generic provider created with
+// gauss.DiscoverOIDCProvider(ctx, server.URL).
+func (server *Server) discovery(responseWriter http.ResponseWriter, request *http.Request) {
+	endpoints := server.Endpoints()
+	writeJSON(responseWriter, http.StatusOK, map[string]interface{}{
+		"issuer":                                endpoints.Issuer,
+		"authorization_endpoint":                endpoints.AuthURL,
+		"token_endpoint":                        endpoints.TokenURL,
+		"userinfo_endpoint":                     endpoints.UserInfoURL,
+		"jwks_uri":                              endpoints.JWKSURL,
+		"revocation_endpoint":                   endpoints.RevocationURL,
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// writeJSON writes body as a JSON response with statusCode.
+func writeJSON(responseWriter http.ResponseWriter, statusCode int, body interface{}) {
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.Header().Set("Cache-Control", "no-store")
+	responseWriter.WriteHeader(statusCode)
+	json.NewEncoder(responseWriter).Encode(body)
+}
+
+// randomValue returns prefix followed by 32 random hex characters.
+func randomValue(prefix string) string {
+	randomBytes := make([]byte, 16)
+	rand.Read(randomBytes)
+	return prefix + hex.EncodeToString(randomBytes)
+}
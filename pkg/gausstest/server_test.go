@@ -0,0 +1,178 @@
+package gausstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/temirov/GAuss/pkg/gauss"
+	"github.com/temirov/GAuss/pkg/session"
+	"golang.org/x/oauth2"
+)
+
+const testRedirectURI = "http://app.example/auth/google/callback"
+
+func newTestServer(t *testing.T, options ...ServerOption) (*Server, *oauth2.Config) {
+	t.Helper()
+	options = append([]ServerOption{WithUser(gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true})}, options...)
+	server := NewServer(t, options...)
+	endpoints := server.Endpoints()
+	config := &oauth2.Config{
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		Endpoint:     oauth2.Endpoint{AuthURL: endpoints.AuthURL, TokenURL: endpoints.TokenURL},
+		RedirectURL:  testRedirectURI,
+		Scopes:       []string{"openid", "email"},
+	}
+	return server, config
+}
+
+// newTestHandlers returns handlers signing in through a test server and a
+// protected handler writing the current user's email and access token.
+func newTestHandlers(t *testing.T) (*gauss.Handlers, http.Handler) {
+	t.Helper()
+	server, _ := newTestServer(t)
+	svc, err := gauss.New(server.ClientID, server.ClientSecret,
+		server.Option(),
+		gauss.WithBaseURL("http://localhost:8080"),
+		gauss.WithSessionStore(session.NewCookieStore([]byte("session-test-secret"))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers, err := gauss.NewHandlers(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := handlers.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := gauss.CurrentUser(r)
+		token, _ := gauss.TokenFromRequest(r)
+		if token != nil {
+			fmt.Fprintf(w, "%s %s", user.Email, token.AccessToken)
+			return
+		}
+		fmt.Fprint(w, user.Email)
+	}))
+	return handlers, protected
+}
+
+// authorizeCode follows the authorization URL and returns the query of the
+// redirect back to the application.
+func authorizeCode(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	location, err := url.Parse(response.Header.Get("Location"))
+	if err != nil || response.StatusCode != http.StatusFound || !strings.HasPrefix(location.String(), testRedirectURI) {
+		t.Fatalf("unexpected authorization response %d %q", response.StatusCode, response.Header.Get("Location"))
+	}
+	return location.Query()
+}
+
+func TestCodeExchange(t *testing.T) {
+	server, config := newTestServer(t)
+	ctx := context.Background()
+
+	verifier := oauth2.GenerateVerifier()
+	query := authorizeCode(t, config.AuthCodeURL("state-1", oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier)))
+	if query.Get("state") != "state-1" || query.Get("code") == "" {
+		t.Fatalf("unexpected redirect query %v", query)
+	}
+	if _, err := config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption("wrong-verifier")); err == nil {
+		t.Fatal("expected a wrong code verifier to be rejected")
+	}
+
+	query = authorizeCode(t, config.AuthCodeURL("state-2", oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier)))
+	token, err := config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.RefreshToken == "" || token.Extra("id_token") == nil {
+		t.Fatalf("expected refresh and ID tokens, got %+v", token)
+	}
+	if _, err := config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(verifier)); err == nil {
+		t.Fatal("expected a used code to be rejected")
+	}
+
+	wrongSecret := *config
+	wrongSecret.ClientSecret = "wrong"
+	query = authorizeCode(t, config.AuthCodeURL("state-3"))
+	if _, err := wrongSecret.Exchange(ctx, query.Get("code")); err == nil {
+		t.Fatal("expected a wrong client secret to be rejected")
+	}
+	if server.RefreshCount() != 0 {
+		t.Fatalf("unexpected refreshes: %d", server.RefreshCount())
+	}
+}
+
+func TestRefreshTokensOnConsent(t *testing.T) {
+	_, config := newTestServer(t, WithRefreshTokens(RefreshTokensOnConsent))
+	testCases := []struct {
+		name        string
+		options     []oauth2.AuthCodeOption
+		wantRefresh bool
+	}{
+		{name: "online", options: nil, wantRefresh: false},
+		{name: "offline", options: []oauth2.AuthCodeOption{oauth2.AccessTypeOffline}, wantRefresh: false},
+		{name: "offline with consent", options: []oauth2.AuthCodeOption{oauth2.AccessTypeOffline, oauth2.ApprovalForce}, wantRefresh: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			query := authorizeCode(t, config.AuthCodeURL("state", testCase.options...))
+			token, err := config.Exchange(context.Background(), query.Get("code"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (token.RefreshToken != "") != testCase.wantRefresh {
+				t.Fatalf("refresh token = %q, want one: %v", token.RefreshToken, testCase.wantRefresh)
+			}
+		})
+	}
+}
+
+func TestRevokeAndTokenInfo(t *testing.T) {
+	server, config := newTestServer(t)
+	ctx := context.Background()
+	query := authorizeCode(t, config.AuthCodeURL("state", oauth2.AccessTypeOffline))
+	token, err := config.Exchange(ctx, query.Get("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenInfoStatus := func() (int, map[string]string) {
+		response, err := http.PostForm(server.Endpoints().TokenInfoURL, url.Values{"access_token": {token.AccessToken}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var body map[string]string
+		json.NewDecoder(response.Body).Decode(&body)
+		return response.StatusCode, body
+	}
+	if statusCode, body := tokenInfoStatus(); statusCode != http.StatusOK || body["sub"] != "1" || body["aud"] != server.ClientID || body["email_verified"] != "true" {
+		t.Fatalf("unexpected tokeninfo response %d %v", statusCode, body)
+	}
+
+	response, err := http.PostForm(server.Endpoints().RevocationURL, url.Values{"token": {token.RefreshToken}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || !server.Revoked(token.RefreshToken) || !server.Revoked(token.AccessToken) {
+		t.Fatal("expected revoking the refresh token to revoke its access token")
+	}
+	if statusCode, _ := tokenInfoStatus(); statusCode != http.StatusBadRequest {
+		t.Fatalf("revoked token was accepted by tokeninfo: %d", statusCode)
+	}
+	if _, err := config.TokenSource(ctx, &oauth2.Token{RefreshToken: token.RefreshToken}).Token(); err == nil {
+		t.Fatal("expected a revoked refresh token to be rejected")
+	}
+}
@@ -0,0 +1,55 @@
+package gausstest
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/temirov/GAuss/pkg/gauss"
+	"golang.org/x/oauth2"
+)
+
+// LoginAs creates a session for user in the session store of handlers, as a
+// completed login would, and returns its cookies. token is stored in the
+// session for TokenFromRequest and TokenSource unless it is nil. No provider
+// is contacted and no hooks run, so tests of AuthMiddleware-protected routes
+// do not need a Server.
+func LoginAs(t testing.TB, handlers *gauss.Handlers, user gauss.GoogleUser, token *oauth2.Token) []*http.Cookie {
+	t.Helper()
+	responseRecorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	if establishError := handlers.EstablishSession(responseRecorder, request, &user, token); establishError != nil {
+		t.Fatalf("gausstest: %v", establishError)
+	}
+	return responseRecorder.Result().Cookies()
+}
+
+// NewAuthenticatedRequest returns an httptest request for target that carries
+// the session cookies of user, created with LoginAs without a token.
+func NewAuthenticatedRequest(t testing.TB, handlers *gauss.Handlers, user gauss.GoogleUser, method string, target string) *http.Request {
+	t.Helper()
+	request := httptest.NewRequest(method, target, nil)
+	for _, cookie := range LoginAs(t, handlers, user, nil) {
+		request.AddCookie(cookie)
+	}
+	return request
+}
+
+// NewAuthenticatedClient returns an http.Client whose cookie jar holds the
+// session cookies of user, created with LoginAs without a token, for the
+// application served at baseURL.
+func NewAuthenticatedClient(t testing.TB, handlers *gauss.Handlers, user gauss.GoogleUser, baseURL string) *http.Client {
+	t.Helper()
+	parsedBaseURL, parseError := url.Parse(baseURL)
+	if parseError != nil {
+		t.Fatalf("gausstest: invalid base URL %q: %v", baseURL, parseError)
+	}
+	jar, jarError := cookiejar.New(nil)
+	if jarError != nil {
+		t.Fatalf("gausstest: %v", jarError)
+	}
+	jar.SetCookies(parsedBaseURL, LoginAs(t, handlers, user, nil))
+	return &http.Client{Jar: jar}
+}
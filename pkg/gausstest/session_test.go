@@ -0,0 +1,49 @@
+package gausstest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/temirov/GAuss/pkg/gauss"
+	"golang.org/x/oauth2"
+)
+
+func TestLoginAs(t *testing.T) {
+	handlers, protected := newTestHandlers(t)
+	alice := gauss.GoogleUser{Subject: "1", Email: "alice@example.com", EmailVerified: true}
+
+	request := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	for _, cookie := range LoginAs(t, handlers, alice, &oauth2.Token{AccessToken: "ya29.test"}) {
+		request.AddCookie(cookie)
+	}
+	responseRecorder := httptest.NewRecorder()
+	protected.ServeHTTP(responseRecorder, request)
+	if responseRecorder.Code != http.StatusOK || responseRecorder.Body.String() != "alice@example.com ya29.test" {
+		t.Fatalf("got %d %q", responseRecorder.Code, responseRecorder.Body.String())
+	}
+
+	responseRecorder = httptest.NewRecorder()
+	protected.ServeHTTP(responseRecorder, NewAuthenticatedRequest(t, handlers, alice, http.MethodGet, "/dashboard"))
+	if responseRecorder.Code != http.StatusOK || responseRecorder.Body.String() != "alice@example.com" {
+		t.Fatalf("got %d %q", responseRecorder.Code, responseRecorder.Body.String())
+	}
+}
+
+func TestNewAuthenticatedClient(t *testing.T) {
+	handlers, protected := newTestHandlers(t)
+	app := httptest.NewServer(protected)
+	t.Cleanup(app.Close)
+
+	client := NewAuthenticatedClient(t, handlers, gauss.GoogleUser{Subject: "2", Email: "bob@example.com"}, app.URL)
+	response, err := client.Get(app.URL + "/dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK || string(body) != "bob@example.com" {
+		t.Fatalf("got %d %q", response.StatusCode, body)
+	}
+}
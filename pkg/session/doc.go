@@ -1,6 +1,13 @@
-// Package session wraps gorilla/sessions to provide a global cookie store used
-// by GAuss. Call NewSession with your secret key at startup to initialize the
-// store and then use Store to retrieve it whenever a handler needs access to the
-// session. The package is intentionally small so that other packages can share
-// session management without having to configure gorilla/sessions directly.
+// Package session wraps gorilla/sessions to provide the cookie stores used by
+// GAuss. NewCookieStore creates an independent store with the GAuss default
+// cookie options; inject it into a gauss.Service so that each service, and
+// each test, owns its own sessions.
+//
+// ServerStore keeps session values on the server instead of in the cookie.
+// It delegates storage to a Backend; MemoryBackend and FileBackend are built
+// in, and the cookie only carries a signed, opaque session ID.
+//
+// For compatibility the package also keeps a global cookie store: call
+// NewSession with your secret key at startup and use Store to retrieve it.
+// Services without an injected store fall back to this global store.
 package session
@@ -0,0 +1,153 @@
+package session
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sessionFilePrefix names the files written by FileBackend.
+const sessionFilePrefix = "gauss_session_"
+
+// fileRecord is the on-disk representation of a session.
+type fileRecord struct {
+	ExpiresAt time.Time
+	Values    []byte
+}
+
+// FileBackend keeps each session in its own file inside a directory. Expired
+// sessions are removed when they are next loaded or by Sweep.
+type FileBackend struct {
+	directory string
+	mutex     sync.RWMutex
+}
+
+// NewFileBackend creates a backend that stores sessions in directory,
+// creating it with owner-only permissions if necessary.
+func NewFileBackend(directory string) (*FileBackend, error) {
+	if mkdirError := os.MkdirAll(directory, 0o700); mkdirError != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", mkdirError)
+	}
+	return &FileBackend{directory: directory}, nil
+}
+
+// Load reads the session file for sessionID.
+func (fileBackend *FileBackend) Load(_ context.Context, sessionID string) (map[interface{}]interface{}, error) {
+	if !validSessionID(sessionID) {
+		return nil, ErrSessionNotFound
+	}
+
+	fileBackend.mutex.RLock()
+	record, readError := fileBackend.read(sessionID)
+	fileBackend.mutex.RUnlock()
+	if readError != nil {
+		return nil, readError
+	}
+
+	if !time.Now().Before(record.ExpiresAt) {
+		fileBackend.mutex.Lock()
+		os.Remove(fileBackend.path(sessionID))
+		fileBackend.mutex.Unlock()
+		return nil, ErrSessionNotFound
+	}
+	return DecodeValues(record.Values)
+}
+
+// Save writes the session file for sessionID.
+func (fileBackend *FileBackend) Save(_ context.Context, sessionID string, values map[interface{}]interface{}, expiresAt time.Time) error {
+	if !validSessionID(sessionID) {
+		return fmt.Errorf("invalid session ID %q", sessionID)
+	}
+	encodedValues, encodeError := EncodeValues(values)
+	if encodeError != nil {
+		return encodeError
+	}
+
+	fileBackend.mutex.Lock()
+	defer fileBackend.mutex.Unlock()
+
+	temporaryFile, createError := os.CreateTemp(fileBackend.directory, sessionFilePrefix+"*.tmp")
+	if createError != nil {
+		return fmt.Errorf("failed to write session: %w", createError)
+	}
+	encodeError = gob.NewEncoder(temporaryFile).Encode(fileRecord{ExpiresAt: expiresAt, Values: encodedValues})
+	closeError := temporaryFile.Close()
+	if encodeError != nil || closeError != nil {
+		os.Remove(temporaryFile.Name())
+		return fmt.Errorf("failed to write session: %w", errors.Join(encodeError, closeError))
+	}
+	if renameError := os.Rename(temporaryFile.Name(), fileBackend.path(sessionID)); renameError != nil {
+		os.Remove(temporaryFile.Name())
+		return fmt.Errorf("failed to write session: %w", renameError)
+	}
+	return nil
+}
+
+// Delete removes the session file for sessionID if present.
+func (fileBackend *FileBackend) Delete(_ context.Context, sessionID string) error {
+	if !validSessionID(sessionID) {
+		return nil
+	}
+
+	fileBackend.mutex.Lock()
+	defer fileBackend.mutex.Unlock()
+
+	if removeError := os.Remove(fileBackend.path(sessionID)); removeError != nil && !errors.Is(removeError, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete session: %w", removeError)
+	}
+	return nil
+}
+
+// Sweep removes every expired session file and returns how many were removed.
+func (fileBackend *FileBackend) Sweep() (int, error) {
+	fileBackend.mutex.Lock()
+	defer fileBackend.mutex.Unlock()
+
+	sessionFiles, globError := filepath.Glob(filepath.Join(fileBackend.directory, sessionFilePrefix+"*"))
+	if globError != nil {
+		return 0, globError
+	}
+	now := time.Now()
+	removed := 0
+	for _, sessionFile := range sessionFiles {
+		sessionID := filepath.Base(sessionFile)[len(sessionFilePrefix):]
+		if !validSessionID(sessionID) {
+			continue
+		}
+		record, readError := fileBackend.read(sessionID)
+		if readError != nil || now.Before(record.ExpiresAt) {
+			continue
+		}
+		if os.Remove(sessionFile) == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// read decodes the session file for sessionID. The caller must hold the mutex.
+func (fileBackend *FileBackend) read(sessionID string) (*fileRecord, error) {
+	sessionFile, openError := os.Open(fileBackend.path(sessionID))
+	if errors.Is(openError, os.ErrNotExist) {
+		return nil, ErrSessionNotFound
+	}
+	if openError != nil {
+		return nil, fmt.Errorf("failed to read session: %w", openError)
+	}
+	defer sessionFile.Close()
+
+	var record fileRecord
+	if decodeError := gob.NewDecoder(sessionFile).Decode(&record); decodeError != nil {
+		return nil, fmt.Errorf("failed to read session: %w", decodeError)
+	}
+	return &record, nil
+}
+
+func (fileBackend *FileBackend) path(sessionID string) string {
+	return filepath.Join(fileBackend.directory, sessionFilePrefix+sessionID)
+}
@@ -0,0 +1,74 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileBackendRoundTrip(t *testing.T) {
+	directory := t.TempDir()
+	backend, err := NewFileBackend(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := backend.Save(ctx, "ABC234", map[interface{}]interface{}{"user_email": "e@example.com"}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	values, err := backend.Load(ctx, "ABC234")
+	if err != nil || values["user_email"] != "e@example.com" {
+		t.Fatalf("expected stored session, got %v, %v", values, err)
+	}
+
+	if err := backend.Delete(ctx, "ABC234"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Load(ctx, "ABC234"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound after delete, got %v", err)
+	}
+}
+
+func TestFileBackendExpiryAndSweep(t *testing.T) {
+	directory := t.TempDir()
+	backend, err := NewFileBackend(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	backend.Save(ctx, "EXPIRED", map[interface{}]interface{}{}, time.Now().Add(-time.Second))
+	backend.Save(ctx, "STALE", map[interface{}]interface{}{}, time.Now().Add(-time.Second))
+	backend.Save(ctx, "LIVE", map[interface{}]interface{}{}, time.Now().Add(time.Hour))
+
+	if _, err := backend.Load(ctx, "EXPIRED"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound for expired session, got %v", err)
+	}
+	removed, err := backend.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected one stale session to be swept, got %d", removed)
+	}
+	if _, err := os.Stat(filepath.Join(directory, sessionFilePrefix+"LIVE")); err != nil {
+		t.Fatalf("live session should remain: %v", err)
+	}
+}
+
+func TestFileBackendRejectsPathTraversal(t *testing.T) {
+	backend, err := NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Save(context.Background(), "../escape", map[interface{}]interface{}{}, time.Now().Add(time.Hour)); err == nil {
+		t.Fatal("expected invalid session ID error")
+	}
+	if _, err := backend.Load(context.Background(), "../escape"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryRecord is a session held by MemoryBackend.
+type memoryRecord struct {
+	values    map[interface{}]interface{}
+	expiresAt time.Time
+}
+
+// MemoryBackend keeps sessions in process memory. Expired sessions are never
+// returned and are evicted periodically by a background sweeper. It suits
+// single-instance deployments and tests; sessions are lost on restart.
+type MemoryBackend struct {
+	mutex     sync.Mutex
+	records   map[string]memoryRecord
+	stopSweep chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMemoryBackend creates an in-memory backend. When sweepInterval is
+// positive a goroutine evicts expired sessions at that interval until Close is
+// called.
+func NewMemoryBackend(sweepInterval time.Duration) *MemoryBackend {
+	memoryBackend := &MemoryBackend{
+		records:   make(map[string]memoryRecord),
+		stopSweep: make(chan struct{}),
+	}
+	if sweepInterval > 0 {
+		go memoryBackend.sweepLoop(sweepInterval)
+	}
+	return memoryBackend
+}
+
+// Load returns a copy of the values stored for sessionID.
+func (memoryBackend *MemoryBackend) Load(_ context.Context, sessionID string) (map[interface{}]interface{}, error) {
+	memoryBackend.mutex.Lock()
+	defer memoryBackend.mutex.Unlock()
+
+	record, found := memoryBackend.records[sessionID]
+	if !found {
+		return nil, ErrSessionNotFound
+	}
+	if !time.Now().Before(record.expiresAt) {
+		delete(memoryBackend.records, sessionID)
+		return nil, ErrSessionNotFound
+	}
+	return copyValues(record.values), nil
+}
+
+// Save stores a copy of values for sessionID until expiresAt.
+func (memoryBackend *MemoryBackend) Save(_ context.Context, sessionID string, values map[interface{}]interface{}, expiresAt time.Time) error {
+	memoryBackend.mutex.Lock()
+	defer memoryBackend.mutex.Unlock()
+
+	memoryBackend.records[sessionID] = memoryRecord{values: copyValues(values), expiresAt: expiresAt}
+	return nil
+}
+
+// Delete removes the session if present.
+func (memoryBackend *MemoryBackend) Delete(_ context.Context, sessionID string) error {
+	memoryBackend.mutex.Lock()
+	defer memoryBackend.mutex.Unlock()
+
+	delete(memoryBackend.records, sessionID)
+	return nil
+}
+
+// Sweep evicts every expired session and returns how many were removed.
+func (memoryBackend *MemoryBackend) Sweep() int {
+	memoryBackend.mutex.Lock()
+	defer memoryBackend.mutex.Unlock()
+
+	now := time.Now()
+	evicted := 0
+	for sessionID, record := range memoryBackend.records {
+		if !now.Before(record.expiresAt) {
+			delete(memoryBackend.records, sessionID)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// Close stops the background sweeper. It is safe to call more than once.
+func (memoryBackend *MemoryBackend) Close() {
+	memoryBackend.closeOnce.Do(func() {
+		close(memoryBackend.stopSweep)
+	})
+}
+
+func (memoryBackend *MemoryBackend) sweepLoop(sweepInterval time.Duration) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			memoryBackend.Sweep()
+		case <-memoryBackend.stopSweep:
+			return
+		}
+	}
+}
+
+// copyValues returns a shallow copy so callers cannot mutate stored sessions.
+func copyValues(values map[interface{}]interface{}) map[interface{}]interface{} {
+	copied := make(map[interface{}]interface{}, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+	return copied
+}
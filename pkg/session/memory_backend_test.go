@@ -0,0 +1,47 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryBackendExpiry(t *testing.T) {
+	backend := NewMemoryBackend(0)
+	ctx := context.Background()
+
+	backend.Save(ctx, "LIVE", map[interface{}]interface{}{"k": "v"}, time.Now().Add(time.Hour))
+	backend.Save(ctx, "EXPIRED", map[interface{}]interface{}{"k": "v"}, time.Now().Add(-time.Second))
+
+	values, err := backend.Load(ctx, "LIVE")
+	if err != nil || values["k"] != "v" {
+		t.Fatalf("expected live session, got %v, %v", values, err)
+	}
+	values["k"] = "mutated"
+	if stored, _ := backend.Load(ctx, "LIVE"); stored["k"] != "v" {
+		t.Fatal("stored values must not be shared with callers")
+	}
+
+	if _, err := backend.Load(ctx, "EXPIRED"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestMemoryBackendSweeper(t *testing.T) {
+	backend := NewMemoryBackend(10 * time.Millisecond)
+	defer backend.Close()
+	backend.Save(context.Background(), "SHORT", map[interface{}]interface{}{}, time.Now().Add(20*time.Millisecond))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		backend.mutex.Lock()
+		remaining := len(backend.records)
+		backend.mutex.Unlock()
+		if remaining == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expired session was not evicted by the sweeper")
+}
@@ -0,0 +1,186 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/base32"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+)
+
+// ErrSessionNotFound is returned by a Backend when no live session exists for
+// the requested ID.
+var ErrSessionNotFound = errors.New("session not found")
+
+// defaultServerSessionTTL is how long a backend keeps sessions whose cookie
+// has no MaxAge and therefore lives until the browser closes.
+const defaultServerSessionTTL = 24 * time.Hour
+
+// sessionIDEncoding renders session IDs with characters that are safe in file
+// names and database keys.
+var sessionIDEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Backend persists session values on the server, keyed by an opaque session
+// ID. Implementations must be safe for concurrent use. Load returns
+// ErrSessionNotFound for unknown or expired sessions.
+type Backend interface {
+	Load(ctx context.Context, sessionID string) (map[interface{}]interface{}, error)
+	Save(ctx context.Context, sessionID string, values map[interface{}]interface{}, expiresAt time.Time) error
+	Delete(ctx context.Context, sessionID string) error
+}
+
+// ServerStore is a gorilla sessions.Store that keeps session values in a
+// Backend. The cookie only carries the signed session ID, so sessions can hold
+// large OAuth tokens without hitting the browser's cookie size limit. It can be
+// assigned to gauss.Service.SessionStore like any other store.
+type ServerStore struct {
+	Codecs  []securecookie.Codec
+	Options *gsessions.Options
+	backend Backend
+}
+
+// NewServerStore creates a ServerStore on top of backend. The key pairs sign
+// (and optionally encrypt) the session ID cookie exactly as for
+// gorilla's CookieStore.
+func NewServerStore(backend Backend, keyPairs ...[]byte) *ServerStore {
+	serverStore := &ServerStore{
+		Codecs:  securecookie.CodecsFromPairs(keyPairs...),
+		Options: defaultOptions(),
+		backend: backend,
+	}
+	serverStore.MaxAge(serverStore.Options.MaxAge)
+	return serverStore
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (serverStore *ServerStore) Get(request *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(request).Get(serverStore, name)
+}
+
+// New returns the session referenced by the request cookie, or a new empty
+// session when the cookie is absent or the backend no longer holds it.
+func (serverStore *ServerStore) New(request *http.Request, name string) (*gsessions.Session, error) {
+	webSession := gsessions.NewSession(serverStore, name)
+	sessionOptions := *serverStore.Options
+	webSession.Options = &sessionOptions
+	webSession.IsNew = true
+
+	sessionCookie, cookieError := request.Cookie(name)
+	if cookieError != nil {
+		return webSession, nil
+	}
+	var sessionID string
+	if decodeError := securecookie.DecodeMulti(name, sessionCookie.Value, &sessionID, serverStore.Codecs...); decodeError != nil {
+		return webSession, decodeError
+	}
+
+	values, loadError := serverStore.backend.Load(request.Context(), sessionID)
+	if errors.Is(loadError, ErrSessionNotFound) {
+		return webSession, nil
+	}
+	if loadError != nil {
+		return webSession, loadError
+	}
+	webSession.ID = sessionID
+	webSession.Values = values
+	webSession.IsNew = false
+	return webSession, nil
+}
+
+// Save persists the session values in the backend and writes the session ID
+// cookie. A negative Options.MaxAge deletes the session from the backend and
+// expires the cookie.
+func (serverStore *ServerStore) Save(request *http.Request, responseWriter http.ResponseWriter, webSession *gsessions.Session) error {
+	if webSession.Options.MaxAge < 0 {
+		if webSession.ID != "" {
+			if deleteError := serverStore.backend.Delete(request.Context(), webSession.ID); deleteError != nil {
+				return deleteError
+			}
+		}
+		http.SetCookie(responseWriter, gsessions.NewCookie(webSession.Name(), "", webSession.Options))
+		return nil
+	}
+
+	if webSession.ID == "" {
+		webSession.ID = sessionIDEncoding.EncodeToString(securecookie.GenerateRandomKey(32))
+	}
+	timeToLive := time.Duration(webSession.Options.MaxAge) * time.Second
+	if timeToLive == 0 {
+		timeToLive = defaultServerSessionTTL
+	}
+	if saveError := serverStore.backend.Save(request.Context(), webSession.ID, webSession.Values, time.Now().Add(timeToLive)); saveError != nil {
+		return saveError
+	}
+
+	encodedID, encodeError := securecookie.EncodeMulti(webSession.Name(), webSession.ID, serverStore.Codecs...)
+	if encodeError != nil {
+		return encodeError
+	}
+	http.SetCookie(responseWriter, gsessions.NewCookie(webSession.Name(), encodedID, webSession.Options))
+	return nil
+}
+
+// Renew deletes the backend record of webSession and clears its ID, so the
+// next Save stores the values under a fresh ID. Call it when the session is
+// authenticated, so an ID planted in the visitor's browser before the login
+// cannot be used to share the session.
+func (serverStore *ServerStore) Renew(request *http.Request, webSession *gsessions.Session) error {
+	if webSession.ID == "" {
+		return nil
+	}
+	if deleteError := serverStore.backend.Delete(request.Context(), webSession.ID); deleteError != nil {
+		return deleteError
+	}
+	webSession.ID = ""
+	return nil
+}
+
+// MaxAge sets the maximum age for the store and for the signed ID cookie.
+func (serverStore *ServerStore) MaxAge(age int) {
+	serverStore.Options.MaxAge = age
+	for _, codec := range serverStore.Codecs {
+		if secureCookie, ok := codec.(*securecookie.SecureCookie); ok {
+			secureCookie.MaxAge(age)
+		}
+	}
+}
+
+// EncodeValues serializes session values with encoding/gob, the same encoding
+// gorilla uses for cookies. Backends that store bytes can use it together with
+// DecodeValues.
+func EncodeValues(values map[interface{}]interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	if encodeError := gob.NewEncoder(&buffer).Encode(values); encodeError != nil {
+		return nil, fmt.Errorf("failed to encode session values: %w", encodeError)
+	}
+	return buffer.Bytes(), nil
+}
+
+// DecodeValues restores session values produced by EncodeValues.
+func DecodeValues(data []byte) (map[interface{}]interface{}, error) {
+	values := make(map[interface{}]interface{})
+	if decodeError := gob.NewDecoder(bytes.NewReader(data)).Decode(&values); decodeError != nil {
+		return nil, fmt.Errorf("failed to decode session values: %w", decodeError)
+	}
+	return values, nil
+}
+
+// validSessionID reports whether sessionID only uses the characters produced
+// by ServerStore, so backends can safely use it in file names.
+func validSessionID(sessionID string) bool {
+	if sessionID == "" {
+		return false
+	}
+	for _, character := range sessionID {
+		if (character < 'A' || character > 'Z') && (character < '2' || character > '7') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerStoreRoundTrip(t *testing.T) {
+	backend := NewMemoryBackend(0)
+	store := NewServerStore(backend, []byte("secret"))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	sess, err := store.Get(req, "gauss_session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	largeValue := strings.Repeat("x", 8192)
+	sess.Values["oauth_token"] = largeValue
+	if err := sess.Save(req, rr); err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := rr.Result().Cookies()[0]
+	if len(cookie.Value) > 200 {
+		t.Fatalf("cookie should only carry the session ID, got %d bytes", len(cookie.Value))
+	}
+
+	chkReq := httptest.NewRequest("GET", "/", nil)
+	chkReq.AddCookie(cookie)
+	loaded, err := store.Get(chkReq, "gauss_session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.IsNew || loaded.Values["oauth_token"] != largeValue {
+		t.Fatalf("session values were not restored")
+	}
+
+	// Expiring the session deletes it from the backend.
+	loaded.Options.MaxAge = -1
+	if err := loaded.Save(chkReq, httptest.NewRecorder()); err != nil {
+		t.Fatal(err)
+	}
+	againReq := httptest.NewRequest("GET", "/", nil)
+	againReq.AddCookie(cookie)
+	again, _ := store.Get(againReq, "gauss_session")
+	if !again.IsNew || len(again.Values) != 0 {
+		t.Fatal("deleted session should not be restored")
+	}
+}
+
+func TestServerStoreRenew(t *testing.T) {
+	store := NewServerStore(NewMemoryBackend(0), []byte("secret"))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	sess, _ := store.Get(req, "gauss_session")
+	sess.Values["oauth_state"] = "state"
+	if err := sess.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal(err)
+	}
+	oldID := sess.ID
+
+	if err := store.Renew(req, sess); err != nil {
+		t.Fatal(err)
+	}
+	sess.Values["user_email"] = "e@example.com"
+	rr := httptest.NewRecorder()
+	if err := sess.Save(req, rr); err != nil {
+		t.Fatal(err)
+	}
+	if sess.ID == "" || sess.ID == oldID {
+		t.Fatalf("expected a fresh session ID, got %q", sess.ID)
+	}
+	if _, err := store.backend.Load(req.Context(), oldID); err != ErrSessionNotFound {
+		t.Fatalf("expected the old session to be deleted, got %v", err)
+	}
+
+	chkReq := httptest.NewRequest("GET", "/", nil)
+	chkReq.AddCookie(rr.Result().Cookies()[0])
+	loaded, _ := store.Get(chkReq, "gauss_session")
+	if loaded.ID != sess.ID || loaded.Values["user_email"] != "e@example.com" || loaded.Values["oauth_state"] != "state" {
+		t.Fatal("renewed session values were not restored")
+	}
+}
+
+func TestServerStoreRejectsForgedCookie(t *testing.T) {
+	store := NewServerStore(NewMemoryBackend(0), []byte("secret"))
+	other := NewServerStore(NewMemoryBackend(0), []byte("other"))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	sess, _ := other.Get(req, "gauss_session")
+	sess.Values["user_email"] = "e@example.com"
+	sess.Save(req, rr)
+
+	chkReq := httptest.NewRequest("GET", "/", nil)
+	chkReq.AddCookie(rr.Result().Cookies()[0])
+	loaded, err := store.Get(chkReq, "gauss_session")
+	if err == nil {
+		t.Fatal("expected a decode error for a cookie signed with another key")
+	}
+	if len(loaded.Values) != 0 {
+		t.Fatal("forged cookie must yield an empty session")
+	}
+}
+
+func TestEncodeDecodeValues(t *testing.T) {
+	values := map[interface{}]interface{}{"user_email": "e@example.com", "user_email_verified": true}
+	data, err := EncodeValues(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeValues(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded["user_email"] != "e@example.com" || decoded["user_email_verified"] != true {
+		t.Fatalf("unexpected values: %v", decoded)
+	}
+}
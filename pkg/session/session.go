@@ -6,11 +6,18 @@ import (
 
 var store *gsessions.CookieStore
 
-// NewSession initializes the package-level cookie store with the given secret.
-// It should be called once at application startup.
-func NewSession(secret []byte) {
-	store = gsessions.NewCookieStore(secret)
-	store.Options = &gsessions.Options{
+// NewCookieStore creates a cookie store signed with the given secret and
+// configured with the GAuss default cookie options. Each call returns an
+// independent store, so several GAuss services can run in one process.
+func NewCookieStore(secret []byte) *gsessions.CookieStore {
+	cookieStore := gsessions.NewCookieStore(secret)
+	cookieStore.Options = defaultOptions()
+	return cookieStore
+}
+
+// defaultOptions returns the cookie options shared by all GAuss stores.
+func defaultOptions() *gsessions.Options {
+	return &gsessions.Options{
 		Path:     "/",
 		MaxAge:   86400 * 7,
 		HttpOnly: true,
@@ -18,6 +25,13 @@ func NewSession(secret []byte) {
 	}
 }
 
+// NewSession initializes the package-level cookie store with the given secret.
+// It should be called once at application startup. New code should prefer
+// NewCookieStore and inject the store into gauss.Service instead.
+func NewSession(secret []byte) {
+	store = NewCookieStore(secret)
+}
+
 // Store returns the global session store previously created with NewSession.
 // It panics if NewSession has not been called.
 func Store() *gsessions.CookieStore {
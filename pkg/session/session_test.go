@@ -20,3 +20,18 @@ func TestNewSessionAndStore(t *testing.T) {
 		t.Fatal("store should not be nil after initialization")
 	}
 }
+
+func TestNewCookieStoreIndependent(t *testing.T) {
+	first := NewCookieStore([]byte("first"))
+	second := NewCookieStore([]byte("second"))
+	if first == second {
+		t.Fatal("expected independent stores")
+	}
+	if first.Options.MaxAge != 86400*7 || !first.Options.HttpOnly {
+		t.Fatalf("unexpected default options: %+v", first.Options)
+	}
+	first.Options.MaxAge = 60
+	if second.Options.MaxAge == 60 {
+		t.Fatal("stores must not share options")
+	}
+}
@@ -0,0 +1,13 @@
+// Package sqlstore implements session.Backend on top of database/sql so that
+// several application replicas can share GAuss sessions and the OAuth tokens
+// stored in them.
+//
+// Create a Store with New, run Migrate once at startup to create the sessions
+// table, and wrap the store with session.NewServerStore. The oauth_token value
+// of every session is kept in its own column, encrypted with AES-GCM and bound
+// to the session ID. Expired rows are removed by Sweep or by a background
+// sweeper started with StartSweeper.
+//
+// SQLite, PostgreSQL and MySQL are supported through the Dialect values; the
+// caller registers the database driver.
+package sqlstore
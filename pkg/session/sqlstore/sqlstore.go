@@ -0,0 +1,278 @@
+package sqlstore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/temirov/GAuss/pkg/constants"
+	"github.com/temirov/GAuss/pkg/session"
+)
+
+// DefaultTableName is the sessions table used when Config.TableName is empty.
+const DefaultTableName = "gauss_sessions"
+
+// tableNamePattern restricts table names to plain identifiers because they
+// are interpolated into SQL statements.
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Dialect captures the SQL differences between the supported databases.
+type Dialect struct {
+	binaryType         string
+	numberedParams     bool
+	inlineIndex        bool
+	createIndexIfNew   bool
+	duplicateKeyUpdate bool
+}
+
+var (
+	// SQLite targets SQLite 3, for example through modernc.org/sqlite.
+	SQLite = Dialect{binaryType: "BLOB", createIndexIfNew: true}
+	// PostgreSQL targets PostgreSQL 9.5 or later.
+	PostgreSQL = Dialect{binaryType: "BYTEA", numberedParams: true, createIndexIfNew: true}
+	// MySQL targets MySQL 5.7 / MariaDB 10.2 or later.
+	MySQL = Dialect{binaryType: "LONGBLOB", inlineIndex: true, duplicateKeyUpdate: true}
+)
+
+// placeholder returns the bind parameter for the given 1-based position.
+func (dialect Dialect) placeholder(position int) string {
+	if dialect.numberedParams {
+		return "$" + strconv.Itoa(position)
+	}
+	return "?"
+}
+
+// Config configures a Store.
+//
+// EncryptionKey is the AES key (16, 24 or 32 bytes) used to encrypt the
+// oauth_token value of each session. TableName defaults to DefaultTableName
+// and Dialect defaults to SQLite.
+type Config struct {
+	TableName     string
+	Dialect       Dialect
+	EncryptionKey []byte
+}
+
+// Store is a session.Backend that keeps sessions in a SQL table. It is safe
+// for concurrent use by multiple goroutines and processes.
+type Store struct {
+	database  *sql.DB
+	tableName string
+	dialect   Dialect
+	tokenAEAD cipher.AEAD
+}
+
+var _ session.Backend = (*Store)(nil)
+
+// New creates a Store on an open database handle.
+func New(database *sql.DB, config Config) (*Store, error) {
+	if database == nil {
+		return nil, errors.New("sqlstore: database is nil")
+	}
+	tableName := config.TableName
+	if tableName == "" {
+		tableName = DefaultTableName
+	}
+	if !tableNamePattern.MatchString(tableName) {
+		return nil, fmt.Errorf("sqlstore: invalid table name %q", tableName)
+	}
+	dialect := config.Dialect
+	if dialect == (Dialect{}) {
+		dialect = SQLite
+	}
+
+	blockCipher, cipherError := aes.NewCipher(config.EncryptionKey)
+	if cipherError != nil {
+		return nil, fmt.Errorf("sqlstore: invalid encryption key: %w", cipherError)
+	}
+	tokenAEAD, aeadError := cipher.NewGCM(blockCipher)
+	if aeadError != nil {
+		return nil, fmt.Errorf("sqlstore: failed to initialize encryption: %w", aeadError)
+	}
+
+	return &Store{
+		database:  database,
+		tableName: tableName,
+		dialect:   dialect,
+		tokenAEAD: tokenAEAD,
+	}, nil
+}
+
+// MigrationStatements returns the DDL that creates the sessions table and its
+// expiry index. It is exposed for applications that manage schema changes with
+// their own migration tool.
+func (store *Store) MigrationStatements() []string {
+	columns := []string{
+		"id VARCHAR(128) NOT NULL PRIMARY KEY",
+		"data " + store.dialect.binaryType + " NOT NULL",
+		"oauth_token " + store.dialect.binaryType + " NULL",
+		"expires_at BIGINT NOT NULL",
+	}
+	indexName := store.tableName + "_expires_at_idx"
+	if store.dialect.inlineIndex {
+		columns = append(columns, "INDEX "+indexName+" (expires_at)")
+	}
+
+	statements := []string{
+		"CREATE TABLE IF NOT EXISTS " + store.tableName + " (" + strings.Join(columns, ", ") + ")",
+	}
+	if store.dialect.createIndexIfNew {
+		statements = append(statements, "CREATE INDEX IF NOT EXISTS "+indexName+" ON "+store.tableName+" (expires_at)")
+	}
+	return statements
+}
+
+// Migrate creates the sessions table and index if they do not exist yet. It
+// is safe to run on every startup.
+func (store *Store) Migrate(ctx context.Context) error {
+	for _, statement := range store.MigrationStatements() {
+		if _, execError := store.database.ExecContext(ctx, statement); execError != nil {
+			return fmt.Errorf("sqlstore: migration failed: %w", execError)
+		}
+	}
+	return nil
+}
+
+// Load returns the values of a live session, decrypting its OAuth token.
+func (store *Store) Load(ctx context.Context, sessionID string) (map[interface{}]interface{}, error) {
+	query := "SELECT data, oauth_token FROM " + store.tableName +
+		" WHERE id = " + store.dialect.placeholder(1) + " AND expires_at > " + store.dialect.placeholder(2)
+
+	var (
+		encodedValues  []byte
+		encryptedToken []byte
+	)
+	scanError := store.database.QueryRowContext(ctx, query, sessionID, time.Now().Unix()).Scan(&encodedValues, &encryptedToken)
+	if errors.Is(scanError, sql.ErrNoRows) {
+		return nil, session.ErrSessionNotFound
+	}
+	if scanError != nil {
+		return nil, fmt.Errorf("sqlstore: failed to load session: %w", scanError)
+	}
+
+	values, decodeError := session.DecodeValues(encodedValues)
+	if decodeError != nil {
+		return nil, fmt.Errorf("sqlstore: %w", decodeError)
+	}
+	if encryptedToken != nil {
+		tokenValue, decryptError := store.decryptToken(sessionID, encryptedToken)
+		if decryptError != nil {
+			return nil, decryptError
+		}
+		values[constants.SessionKeyOAuthToken] = tokenValue
+	}
+	return values, nil
+}
+
+// Save writes the session row, storing the OAuth token encrypted in its own
+// column and every other value in the data column.
+func (store *Store) Save(ctx context.Context, sessionID string, values map[interface{}]interface{}, expiresAt time.Time) error {
+	remainingValues := make(map[interface{}]interface{}, len(values))
+	var encryptedToken []byte
+	for key, value := range values {
+		if key == constants.SessionKeyOAuthToken {
+			tokenValue, isString := value.(string)
+			if !isString {
+				return fmt.Errorf("sqlstore: %s must be a string, got %T", constants.SessionKeyOAuthToken, value)
+			}
+			sealedToken, encryptError := store.encryptToken(sessionID, tokenValue)
+			if encryptError != nil {
+				return encryptError
+			}
+			encryptedToken = sealedToken
+			continue
+		}
+		remainingValues[key] = value
+	}
+	encodedValues, encodeError := session.EncodeValues(remainingValues)
+	if encodeError != nil {
+		return fmt.Errorf("sqlstore: %w", encodeError)
+	}
+
+	if _, execError := store.database.ExecContext(ctx, store.saveStatement(), sessionID, encodedValues, encryptedToken, expiresAt.Unix()); execError != nil {
+		return fmt.Errorf("sqlstore: failed to save session: %w", execError)
+	}
+	return nil
+}
+
+// saveStatement returns the single-statement upsert of a session row, so
+// concurrent saves of one session overwrite each other instead of failing
+// on the primary key or deadlocking.
+func (store *Store) saveStatement() string {
+	statement := "INSERT INTO " + store.tableName + " (id, data, oauth_token, expires_at) VALUES (" +
+		store.dialect.placeholder(1) + ", " + store.dialect.placeholder(2) + ", " +
+		store.dialect.placeholder(3) + ", " + store.dialect.placeholder(4) + ")"
+	if store.dialect.duplicateKeyUpdate {
+		return statement + " ON DUPLICATE KEY UPDATE data = VALUES(data), oauth_token = VALUES(oauth_token), expires_at = VALUES(expires_at)"
+	}
+	return statement + " ON CONFLICT (id) DO UPDATE SET data = excluded.data, oauth_token = excluded.oauth_token, expires_at = excluded.expires_at"
+}
+
+// Delete removes the session row if present.
+func (store *Store) Delete(ctx context.Context, sessionID string) error {
+	statement := "DELETE FROM " + store.tableName + " WHERE id = " + store.dialect.placeholder(1)
+	if _, execError := store.database.ExecContext(ctx, statement, sessionID); execError != nil {
+		return fmt.Errorf("sqlstore: failed to delete session: %w", execError)
+	}
+	return nil
+}
+
+// Sweep deletes every expired session and returns how many rows were removed.
+func (store *Store) Sweep(ctx context.Context) (int64, error) {
+	statement := "DELETE FROM " + store.tableName + " WHERE expires_at <= " + store.dialect.placeholder(1)
+	result, execError := store.database.ExecContext(ctx, statement, time.Now().Unix())
+	if execError != nil {
+		return 0, fmt.Errorf("sqlstore: failed to sweep sessions: %w", execError)
+	}
+	return result.RowsAffected()
+}
+
+// StartSweeper runs Sweep every interval in a background goroutine until ctx
+// is canceled. Sweep errors are passed to onError when it is not nil.
+func (store *Store) StartSweeper(ctx context.Context, interval time.Duration, onError func(error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, sweepError := store.Sweep(ctx); sweepError != nil && onError != nil {
+					onError(sweepError)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// encryptToken seals tokenValue with AES-GCM, using the session ID as
+// additional data so a ciphertext cannot be moved to another row.
+func (store *Store) encryptToken(sessionID string, tokenValue string) ([]byte, error) {
+	nonce := make([]byte, store.tokenAEAD.NonceSize())
+	if _, readError := rand.Read(nonce); readError != nil {
+		return nil, fmt.Errorf("sqlstore: failed to generate nonce: %w", readError)
+	}
+	return store.tokenAEAD.Seal(nonce, nonce, []byte(tokenValue), []byte(sessionID)), nil
+}
+
+// decryptToken reverses encryptToken.
+func (store *Store) decryptToken(sessionID string, encryptedToken []byte) (string, error) {
+	nonceSize := store.tokenAEAD.NonceSize()
+	if len(encryptedToken) < nonceSize {
+		return "", errors.New("sqlstore: encrypted token is truncated")
+	}
+	plaintext, openError := store.tokenAEAD.Open(nil, encryptedToken[:nonceSize], encryptedToken[nonceSize:], []byte(sessionID))
+	if openError != nil {
+		return "", fmt.Errorf("sqlstore: failed to decrypt token: %w", openError)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,202 @@
+package sqlstore
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/temirov/GAuss/pkg/constants"
+	"github.com/temirov/GAuss/pkg/session"
+	_ "modernc.org/sqlite"
+)
+
+func newTestStore(t *testing.T) (*Store, *sql.DB) {
+	t.Helper()
+	database, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	store, err := New(database, Config{EncryptionKey: bytes.Repeat([]byte("k"), 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Migrations must be idempotent.
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatalf("second migration failed: %v", err)
+	}
+	return store, database
+}
+
+func TestStoreRoundTripEncryptsToken(t *testing.T) {
+	store, database := newTestStore(t)
+	ctx := context.Background()
+	tokenJSON := `{"access_token":"secret-access","refresh_token":"secret-refresh"}`
+
+	values := map[interface{}]interface{}{
+		constants.SessionKeyUserEmail:  "e@example.com",
+		constants.SessionKeyOAuthToken: tokenJSON,
+	}
+	if err := store.Save(ctx, "SESSION1", values, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	// Saving again replaces the row.
+	values[constants.SessionKeyUserName] = "tester"
+	if err := store.Save(ctx, "SESSION1", values, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.Load(ctx, "SESSION1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded[constants.SessionKeyOAuthToken] != tokenJSON || loaded[constants.SessionKeyUserName] != "tester" {
+		t.Fatalf("unexpected values: %v", loaded)
+	}
+
+	var data, encryptedToken []byte
+	if err := database.QueryRow("SELECT data, oauth_token FROM gauss_sessions WHERE id = ?", "SESSION1").Scan(&data, &encryptedToken); err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range [][]byte{data, encryptedToken} {
+		if bytes.Contains(column, []byte("secret-refresh")) {
+			t.Fatal("refresh token stored in plaintext")
+		}
+	}
+
+	// A ciphertext copied to another row must not decrypt.
+	if _, err := database.Exec("INSERT INTO gauss_sessions (id, data, oauth_token, expires_at) VALUES (?, ?, ?, ?)", "SESSION2", data, encryptedToken, time.Now().Add(time.Hour).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(ctx, "SESSION2"); err == nil {
+		t.Fatal("expected decryption failure for a moved token")
+	}
+}
+
+func TestStoreExpiryAndSweep(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+
+	store.Save(ctx, "EXPIRED", map[interface{}]interface{}{"k": "v"}, time.Now().Add(-time.Minute))
+	store.Save(ctx, "LIVE", map[interface{}]interface{}{"k": "v"}, time.Now().Add(time.Hour))
+
+	if _, err := store.Load(ctx, "EXPIRED"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+	removed, err := store.Sweep(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected one expired row to be swept, got %d", removed)
+	}
+	if _, err := store.Load(ctx, "LIVE"); err != nil {
+		t.Fatalf("live session should survive the sweep: %v", err)
+	}
+
+	if err := store.Delete(ctx, "LIVE"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(ctx, "LIVE"); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound after delete, got %v", err)
+	}
+}
+
+func TestStoreSharedAcrossReplicas(t *testing.T) {
+	store, database := newTestStore(t)
+	replica, err := New(database, Config{EncryptionKey: bytes.Repeat([]byte("k"), 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := session.NewServerStore(store, []byte("secret"))
+	second := session.NewServerStore(replica, []byte("secret"))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	sess, _ := first.Get(req, constants.SessionName)
+	sess.Values[constants.SessionKeyUserEmail] = "e@example.com"
+	sess.Values[constants.SessionKeyOAuthToken] = `{"refresh_token":"rtok"}`
+	if err := sess.Save(req, rr); err != nil {
+		t.Fatal(err)
+	}
+
+	chkReq := httptest.NewRequest("GET", "/", nil)
+	chkReq.AddCookie(rr.Result().Cookies()[0])
+	loaded, err := second.Get(chkReq, constants.SessionName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Values[constants.SessionKeyOAuthToken] != `{"refresh_token":"rtok"}` {
+		t.Fatalf("session not shared across replicas: %v", loaded.Values)
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	database, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	if _, err := New(database, Config{EncryptionKey: []byte("short")}); err == nil {
+		t.Fatal("expected error for an invalid key length")
+	}
+	if _, err := New(database, Config{TableName: "sessions; DROP TABLE users", EncryptionKey: bytes.Repeat([]byte("k"), 32)}); err == nil {
+		t.Fatal("expected error for an invalid table name")
+	}
+}
+
+func TestMigrationStatementsPerDialect(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 32)
+	postgres, _ := New(&sql.DB{}, Config{Dialect: PostgreSQL, EncryptionKey: key})
+	if got := postgres.dialect.placeholder(2); got != "$2" {
+		t.Fatalf("unexpected PostgreSQL placeholder %q", got)
+	}
+	if statements := postgres.MigrationStatements(); len(statements) != 2 || !bytes.Contains([]byte(statements[0]), []byte("BYTEA")) {
+		t.Fatalf("unexpected PostgreSQL migration: %v", statements)
+	}
+	if statement := postgres.saveStatement(); !strings.Contains(statement, "ON CONFLICT (id) DO UPDATE") || !strings.Contains(statement, "$4") {
+		t.Fatalf("unexpected PostgreSQL upsert: %s", statement)
+	}
+	mysql, _ := New(&sql.DB{}, Config{Dialect: MySQL, EncryptionKey: key})
+	if statements := mysql.MigrationStatements(); len(statements) != 1 || !bytes.Contains([]byte(statements[0]), []byte("INDEX gauss_sessions_expires_at_idx")) {
+		t.Fatalf("unexpected MySQL migration: %v", statements)
+	}
+	if statement := mysql.saveStatement(); !strings.Contains(statement, "ON DUPLICATE KEY UPDATE") || strings.Contains(statement, "ON CONFLICT") {
+		t.Fatalf("unexpected MySQL upsert: %s", statement)
+	}
+}
+
+func TestStoreSaveOverwrites(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+
+	if err := store.Save(ctx, "SESSION", map[interface{}]interface{}{constants.SessionKeyOAuthState: "state"}, expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	updated := map[interface{}]interface{}{
+		constants.SessionKeyUserEmail:  "e@example.com",
+		constants.SessionKeyOAuthToken: `{"access_token":"abc"}`,
+	}
+	if err := store.Save(ctx, "SESSION", updated, expiresAt.Add(time.Hour)); err != nil {
+		t.Fatalf("saving an existing session failed: %v", err)
+	}
+	loaded, err := store.Load(ctx, "SESSION")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded[constants.SessionKeyUserEmail] != "e@example.com" || loaded[constants.SessionKeyOAuthToken] != `{"access_token":"abc"}` || loaded[constants.SessionKeyOAuthState] != nil {
+		t.Fatalf("expected the saved values to replace the old ones, got %v", loaded)
+	}
+}